@@ -0,0 +1,258 @@
+package xiao
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Component 是由App管理生命周期的组件
+type Component interface {
+	// Start 启动组件，应当在完成启动后返回，长期运行的任务需要自行开启goroutine，
+	// ctx会在App开始退出时被取消
+	Start(ctx Context) error
+	// Stop 停止组件，ctx带有退出的超时时间
+	Stop(ctx Context) error
+}
+
+// ComponentFuncs 将一组函数适配为Component，nil表示什么也不做
+type ComponentFuncs struct {
+	OnStart func(ctx Context) error
+	OnStop  func(ctx Context) error
+}
+
+func (c ComponentFuncs) Start(ctx Context) error {
+	if c.OnStart == nil {
+		return nil
+	}
+	return c.OnStart(ctx)
+}
+
+func (c ComponentFuncs) Stop(ctx Context) error {
+	if c.OnStop == nil {
+		return nil
+	}
+	return c.OnStop(ctx)
+}
+
+// DefaultShutdownTimeout 是App退出时，停止所有组件的默认超时时间
+const DefaultShutdownTimeout = 30 * time.Second
+
+// ErrAppShutdown 是调用App.Shutdown时，根Context的Cause()
+var ErrAppShutdown = errors.New("app shutdown")
+
+// SignalError 是App收到退出信号时，根Context的Cause()
+type SignalError struct {
+	Signal os.Signal
+}
+
+func (e *SignalError) Error() string {
+	return "received signal " + e.Signal.String()
+}
+
+type appComponent struct {
+	name string
+	comp Component
+	deps []string
+}
+
+// App 管理一组组件的生命周期：按照依赖顺序启动，收到退出信号后按相反的顺序停止，
+// 所有步骤都会通过App的Context输出日志
+type App struct {
+	// ShutdownTimeout 停止所有组件的总超时时间，为0时使用DefaultShutdownTimeout
+	ShutdownTimeout time.Duration
+	// Signals 触发退出的信号，为空时使用SIGINT和SIGTERM
+	Signals []os.Signal
+
+	ctx    Context
+	cancel CancelCauseFunc
+
+	mu      sync.Mutex
+	comps   []*appComponent
+	running bool
+}
+
+// NewApp 返回一个App，name会作为根Context的名称
+func NewApp(name string) *App {
+	var app = &App{}
+	app.ctx, app.cancel = NamedContext(name).WithCancelCause()
+	return app
+}
+
+// Context 返回App的根Context，它会在App开始退出时被取消
+func (app *App) Context() Context {
+	return app.ctx
+}
+
+// Register 注册一个组件，deps为它所依赖的组件名称，依赖的组件会先于它启动、晚于它停止。
+// 依赖的组件可以在之后注册，名称重复或者App已经运行时返回错误。
+func (app *App) Register(name string, comp Component, deps ...string) error {
+	app.mu.Lock()
+	defer app.mu.Unlock()
+	if app.running {
+		return fmt.Errorf("app is running, can not register component %q", name)
+	}
+	for _, c := range app.comps {
+		if c.name == name {
+			return fmt.Errorf("duplicate component %q", name)
+		}
+	}
+	app.comps = append(app.comps, &appComponent{name: name, comp: comp, deps: deps})
+	return nil
+}
+
+// Shutdown 使App开始退出，与收到退出信号的效果相同
+func (app *App) Shutdown() {
+	app.cancel(ErrAppShutdown)
+}
+
+// startOrder 按照依赖关系排序，相互无依赖的组件保持注册的顺序
+func (app *App) startOrder() ([]*appComponent, error) {
+	var (
+		index = make(map[string]*appComponent, len(app.comps))
+		state = make(map[string]int, len(app.comps)) // 1: visiting, 2: done
+		order = make([]*appComponent, 0, len(app.comps))
+		visit func(c *appComponent, path []string) error
+	)
+	for _, c := range app.comps {
+		index[c.name] = c
+	}
+	visit = func(c *appComponent, path []string) error {
+		switch state[c.name] {
+		case 1:
+			return fmt.Errorf("circular dependency: %v", append(path, c.name))
+		case 2:
+			return nil
+		}
+		state[c.name] = 1
+		for _, dep := range c.deps {
+			var d, ok = index[dep]
+			if !ok {
+				return fmt.Errorf("component %q depends on unknown component %q", c.name, dep)
+			}
+			if err := visit(d, append(path, c.name)); err != nil {
+				return err
+			}
+		}
+		state[c.name] = 2
+		order = append(order, c)
+		return nil
+	}
+	for _, c := range app.comps {
+		if err := visit(c, nil); err != nil {
+			return nil, err
+		}
+	}
+	return order, nil
+}
+
+// Run 启动所有组件，然后等待退出信号或者Shutdown，之后停止所有已启动的组件并返回。
+// 任意组件启动失败时，会停止已经启动的组件，并返回启动的错误。Run只能被调用一次。
+func (app *App) Run() error {
+	app.mu.Lock()
+	if app.running {
+		app.mu.Unlock()
+		return errors.New("app is already running")
+	}
+	app.running = true
+	var order, err = app.startOrder()
+	app.mu.Unlock()
+
+	var ctx = app.ctx
+	defer _L.Sync()
+	if err != nil {
+		ctx.Error("invalid components", "err", err)
+		return err
+	}
+
+	var signals = app.Signals
+	if len(signals) == 0 {
+		signals = []os.Signal{syscall.SIGINT, syscall.SIGTERM}
+	}
+	var sigch = make(chan os.Signal, 1)
+	signal.Notify(sigch, signals...)
+	defer signal.Stop(sigch)
+	go func() {
+		select {
+		case sig := <-sigch:
+			ctx.Warn("received signal, shutting down", "signal", sig.String())
+			app.cancel(&SignalError{Signal: sig})
+		case <-ctx.Done():
+		}
+	}()
+
+	ctx.Info("app starting", "components", len(order), "boot_id", BootID)
+	var started []*appComponent
+	var startErr error
+	for _, c := range order {
+		if ctx.Err() != nil {
+			startErr = ctx.Cause()
+			break
+		}
+		var cctx = ctx.At(c.name)
+		var begin = time.Now()
+		cctx.Info("starting component")
+		if err := c.comp.Start(cctx); err != nil {
+			cctx.Error("start component failed", "err", err)
+			startErr = fmt.Errorf("start component %q: %w", c.name, err)
+			break
+		}
+		cctx.Info("component started", "elapsed", time.Since(begin))
+		started = append(started, c)
+	}
+
+	if startErr == nil {
+		ctx.Info("app started", "elapsed", time.Since(BootTime))
+		<-ctx.Done()
+		ctx.Info("app shutting down", "cause", ctx.Cause().Error())
+	} else {
+		app.cancel(startErr)
+	}
+
+	var stopErr = app.stop(started)
+	ctx.Info("app stopped", "uptime", time.Since(BootTime))
+	if startErr != nil {
+		return startErr
+	}
+	return stopErr
+}
+
+// stop 按照启动的相反顺序停止组件，所有组件共享ShutdownTimeout
+func (app *App) stop(started []*appComponent) error {
+	var timeout = app.ShutdownTimeout
+	if timeout <= 0 {
+		timeout = DefaultShutdownTimeout
+	}
+	var ctx, cancel = app.ctx.WithoutCancel().WithTimeout(timeout)
+	defer cancel()
+
+	var errs []error
+	for i := len(started) - 1; i >= 0; i-- {
+		var c = started[i]
+		var cctx = ctx.At(c.name)
+		var begin = time.Now()
+		cctx.Info("stopping component")
+
+		var done = make(chan error, 1)
+		go func() {
+			done <- c.comp.Stop(cctx)
+		}()
+		var err error
+		select {
+		case err = <-done:
+		case <-cctx.Done():
+			err = cctx.Err()
+		}
+		if err != nil {
+			cctx.Error("stop component failed", "err", err, "elapsed", time.Since(begin))
+			errs = append(errs, fmt.Errorf("stop component %q: %w", c.name, err))
+			continue
+		}
+		cctx.Info("component stopped", "elapsed", time.Since(begin))
+	}
+	return errors.Join(errs...)
+}
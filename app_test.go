@@ -0,0 +1,119 @@
+package xiao
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+type recordComponent struct {
+	mu     *sync.Mutex
+	events *[]string
+	name   string
+	err    error
+	block  bool
+}
+
+func (c recordComponent) record(event string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	*c.events = append(*c.events, event+" "+c.name)
+}
+
+func (c recordComponent) Start(ctx Context) error {
+	c.record("start")
+	return c.err
+}
+
+func (c recordComponent) Stop(ctx Context) error {
+	c.record("stop")
+	if c.block {
+		<-ctx.Done()
+	}
+	return nil
+}
+
+func TestApp(t *testing.T) {
+	var mu sync.Mutex
+	var events []string
+	var comp = func(name string) recordComponent {
+		return recordComponent{mu: &mu, events: &events, name: name}
+	}
+
+	var app = NewApp("TestApp")
+	app.Signals = []os.Signal{syscall.SIGUSR1}
+	var started = make(chan struct{})
+	app.Register("http", comp("http"), "db", "cache")
+	app.Register("cache", comp("cache"), "db")
+	app.Register("db", comp("db"))
+	app.Register("ready", ComponentFuncs{OnStart: func(ctx Context) error {
+		close(started)
+		return nil
+	}}, "http")
+	if err := app.Register("db", comp("db")); err == nil {
+		t.Errorf("duplicate component should be rejected")
+	}
+
+	var done = make(chan error, 1)
+	go func() { done <- app.Run() }()
+	<-started
+	syscall.Kill(os.Getpid(), syscall.SIGUSR1)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	var sigerr *SignalError
+	if !errors.As(app.Context().Cause(), &sigerr) || sigerr.Signal != syscall.SIGUSR1 {
+		t.Errorf("unexpected cause: %v", app.Context().Cause())
+	}
+	if s := strings.Join(events, ","); s != "start db,start cache,start http,stop http,stop cache,stop db" {
+		t.Errorf("unexpected events: %s", s)
+	}
+	if err := app.Run(); err == nil {
+		t.Errorf("run twice should fail")
+	}
+}
+
+func TestAppStartFailure(t *testing.T) {
+	var mu sync.Mutex
+	var events []string
+	var app = NewApp("TestAppStartFailure")
+	app.ShutdownTimeout = 10 * time.Millisecond
+	app.Register("a", recordComponent{mu: &mu, events: &events, name: "a", block: true})
+	app.Register("b", recordComponent{mu: &mu, events: &events, name: "b", err: errors.New("boom")}, "a")
+	app.Register("c", recordComponent{mu: &mu, events: &events, name: "c"}, "b")
+
+	var err = app.Run()
+	if err == nil || !strings.Contains(err.Error(), `start component "b": boom`) {
+		t.Errorf("unexpected error: %v", err)
+	}
+	mu.Lock()
+	if s := strings.Join(events, ","); s != "start a,start b,stop a" {
+		t.Errorf("unexpected events: %s", s)
+	}
+	mu.Unlock()
+
+	app = NewApp("TestAppCycle")
+	app.Register("a", ComponentFuncs{}, "b")
+	app.Register("b", ComponentFuncs{}, "a")
+	if err := app.Run(); err == nil || !strings.Contains(err.Error(), "circular dependency") {
+		t.Errorf("unexpected error: %v", err)
+	}
+	app = NewApp("TestAppUnknown")
+	app.Register("a", ComponentFuncs{}, "x")
+	if err := app.Run(); err == nil || !strings.Contains(err.Error(), "unknown component") {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	app = NewApp("TestAppShutdown")
+	app.Register("a", ComponentFuncs{OnStart: func(ctx Context) error {
+		go app.Shutdown()
+		return nil
+	}})
+	if err := app.Run(); err != nil || app.Context().Cause() != ErrAppShutdown {
+		t.Errorf("unexpected result: %v, %v", err, app.Context().Cause())
+	}
+}
@@ -0,0 +1,304 @@
+package xiao
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// AsyncPolicy 定义了异步输出的队列满时的处理策略
+type AsyncPolicy int
+
+const (
+	// AsyncBlock 队列满时阻塞等待
+	AsyncBlock AsyncPolicy = iota
+	// AsyncDropLow 队列满时优先丢弃debug和info等级的日志，新来的低等级日志会被直接丢弃，
+	// 新来的warn及以上等级的日志会挤掉队列中最早的一条低等级日志，如果队列中没有低等级日志，则阻塞等待
+	AsyncDropLow
+	// AsyncDropNewest 队列满时直接丢弃新来的日志
+	AsyncDropNewest
+)
+
+// AsyncConfig 定义了异步输出的配置
+type AsyncConfig struct {
+	// QueueSize 队列长度，默认4096
+	QueueSize int
+	// BatchSize 每次批量写出的最大条数，默认128
+	BatchSize int
+	// Policy 队列满时的处理策略
+	Policy AsyncPolicy
+	// SyncTimeout Sync时等待队列清空的最长时间，默认5秒
+	SyncTimeout time.Duration
+}
+
+// WithAsync 为NewSimpleLogger和NewSinkLogger的每个输出目标开启异步输出，
+// 日志在调用方的goroutine中完成编码，然后进入有界队列，由后台goroutine批量写出。
+// Logger.Sync会在SyncTimeout内等待队列清空，不再使用时需要通过CloseLogger停止后台goroutine并关闭输出。
+// 异步输出仅支持console、json、logfmt和color-console编码。
+func WithAsync(cfg AsyncConfig) SimpleOption {
+	return func(o *simpleOptions) {
+		o.async = &cfg
+	}
+}
+
+var _asyncDropped atomic.Uint64
+
+// AsyncDropped 返回所有异步输出累计丢弃的日志条数
+func AsyncDropped() uint64 {
+	return _asyncDropped.Load()
+}
+
+type asyncItem struct {
+	level zapcore.Level
+	data  []byte
+}
+
+// asyncWriter 是一个有界队列，后台goroutine负责将队列中的数据批量写入out，
+// 写入失败时错误会输出到errOut，并在下一次Sync时返回
+type asyncWriter struct {
+	out    zapcore.WriteSyncer
+	errOut zapcore.WriteSyncer
+	cfg    AsyncConfig
+
+	mu       sync.Mutex
+	notEmpty *sync.Cond
+	notFull  *sync.Cond
+	queue    []asyncItem
+	writing  bool
+	drained  chan struct{} // closed by loop when the queue is drained, created by drain
+	writeErr error
+	closed   bool
+	stopped  chan struct{}
+}
+
+func newAsyncWriter(out zapcore.WriteSyncer, cfg AsyncConfig) *asyncWriter {
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = 4096
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 128
+	}
+	if cfg.SyncTimeout <= 0 {
+		cfg.SyncTimeout = 5 * time.Second
+	}
+	var w = &asyncWriter{
+		out:     out,
+		errOut:  zapcore.Lock(os.Stderr),
+		cfg:     cfg,
+		queue:   make([]asyncItem, 0, cfg.QueueSize),
+		stopped: make(chan struct{}),
+	}
+	w.notEmpty = sync.NewCond(&w.mu)
+	w.notFull = sync.NewCond(&w.mu)
+	go w.loop()
+	return w
+}
+
+func (w *asyncWriter) loop() {
+	defer close(w.stopped)
+	var batch []byte
+	for {
+		w.mu.Lock()
+		for len(w.queue) == 0 {
+			if w.drained != nil {
+				close(w.drained)
+				w.drained = nil
+			}
+			if w.closed {
+				w.mu.Unlock()
+				return
+			}
+			w.notEmpty.Wait()
+		}
+		var n = min(len(w.queue), w.cfg.BatchSize)
+		batch = batch[:0]
+		for _, item := range w.queue[:n] {
+			batch = append(batch, item.data...)
+		}
+		w.queue = append(w.queue[:0], w.queue[n:]...)
+		w.writing = true
+		w.notFull.Broadcast()
+		w.mu.Unlock()
+
+		var _, err = w.out.Write(batch)
+		if err != nil {
+			// the same as zap does for write errors
+			fmt.Fprintf(w.errOut, "%v write error: %v\n", time.Now(), err)
+			w.errOut.Sync()
+		}
+
+		w.mu.Lock()
+		w.writing = false
+		if err != nil {
+			w.writeErr = err
+		}
+		w.mu.Unlock()
+	}
+}
+
+func isLowLevel(lvl zapcore.Level) bool {
+	return lvl <= zapcore.InfoLevel
+}
+
+func (w *asyncWriter) enqueue(lvl zapcore.Level, data []byte) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for len(w.queue) >= w.cfg.QueueSize && !w.closed {
+		switch w.cfg.Policy {
+		case AsyncDropNewest:
+			_asyncDropped.Add(1)
+			return
+		case AsyncDropLow:
+			if isLowLevel(lvl) {
+				_asyncDropped.Add(1)
+				return
+			}
+			for i := range w.queue {
+				if isLowLevel(w.queue[i].level) {
+					w.queue = append(w.queue[:i], w.queue[i+1:]...)
+					_asyncDropped.Add(1)
+					break
+				}
+			}
+			if len(w.queue) < w.cfg.QueueSize {
+				continue
+			}
+		}
+		w.notFull.Wait()
+	}
+
+	if w.closed {
+		_asyncDropped.Add(1)
+		return
+	}
+	w.queue = append(w.queue, asyncItem{level: lvl, data: data})
+	w.notEmpty.Signal()
+}
+
+// drain 等待队列清空，超时则返回错误
+func (w *asyncWriter) drain() error {
+	w.mu.Lock()
+	if len(w.queue) == 0 && !w.writing {
+		w.mu.Unlock()
+		return nil
+	}
+	if w.drained == nil {
+		w.drained = make(chan struct{})
+	}
+	var drained = w.drained
+	w.mu.Unlock()
+
+	var timer = time.NewTimer(w.cfg.SyncTimeout)
+	defer timer.Stop()
+	select {
+	case <-drained:
+		return nil
+	case <-timer.C:
+		return fmt.Errorf("async log queue not drained in %s", w.cfg.SyncTimeout)
+	}
+}
+
+func (w *asyncWriter) Sync() error {
+	if err := w.drain(); err != nil {
+		return err
+	}
+	w.mu.Lock()
+	var err = w.writeErr
+	w.writeErr = nil
+	w.mu.Unlock()
+	return errors.Join(err, w.out.Sync())
+}
+
+// Close 在SyncTimeout内等待队列清空，然后停止后台goroutine，此后的日志都会被丢弃，
+// 超时时队列中剩余的日志也会被丢弃
+func (w *asyncWriter) Close() error {
+	var err = w.drain()
+	w.mu.Lock()
+	w.closed = true
+	if n := len(w.queue); n > 0 {
+		_asyncDropped.Add(uint64(n))
+		w.queue = w.queue[:0]
+	}
+	w.notEmpty.Broadcast()
+	w.notFull.Broadcast()
+	w.mu.Unlock()
+	<-w.stopped
+	return errors.Join(err, w.out.Sync())
+}
+
+// asyncCore 与zapcore.NewCore相同，但将编码后的数据写入asyncWriter
+type asyncCore struct {
+	zapcore.LevelEnabler
+	enc zapcore.Encoder
+	out *asyncWriter
+	// closeOut closes the underlying output, shared by all derived cores
+	closeOut func()
+	once     *sync.Once
+}
+
+func newAsyncCore(enc zapcore.Encoder, out zapcore.WriteSyncer, closeOut func(), enab zapcore.LevelEnabler, cfg AsyncConfig) *asyncCore {
+	return &asyncCore{
+		LevelEnabler: enab,
+		enc:          enc,
+		out:          newAsyncWriter(out, cfg),
+		closeOut:     closeOut,
+		once:         new(sync.Once),
+	}
+}
+
+func (c *asyncCore) Level() zapcore.Level {
+	return zapcore.LevelOf(c.LevelEnabler)
+}
+
+func (c *asyncCore) With(fields []zapcore.Field) zapcore.Core {
+	var c2 = &asyncCore{LevelEnabler: c.LevelEnabler, enc: c.enc.Clone(), out: c.out, closeOut: c.closeOut, once: c.once}
+	for i := range fields {
+		fields[i].AddTo(c2.enc)
+	}
+	return c2
+}
+
+func (c *asyncCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *asyncCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	var buf, err = c.enc.EncodeEntry(ent, fields)
+	if err != nil {
+		return err
+	}
+	var data = make([]byte, buf.Len())
+	copy(data, buf.Bytes())
+	buf.Free()
+
+	c.out.enqueue(ent.Level, data)
+	if ent.Level > zapcore.ErrorLevel {
+		// Since we may be crashing the program, sync the output.
+		return c.Sync()
+	}
+	return nil
+}
+
+func (c *asyncCore) Sync() error {
+	return c.out.Sync()
+}
+
+// Close 停止后台goroutine并关闭输出，由CloseLogger调用
+func (c *asyncCore) Close() (err error) {
+	c.once.Do(func() {
+		err = c.out.Close()
+		if c.closeOut != nil {
+			c.closeOut()
+		}
+	})
+	return err
+}
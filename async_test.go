@@ -0,0 +1,177 @@
+package xiao
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+func TestAsyncLogger(t *testing.T) {
+	var path = filepath.Join(t.TempDir(), "async.log")
+	var logger, err = NewSimpleLogger("info", path, "json", true, WithAsync(AsyncConfig{BatchSize: 16}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer CloseLogger(logger)
+	defer ReplaceLogger(logger)()
+
+	var ctx = NamedContext("TestAsync")
+	for i := 0; i < 1000; i++ {
+		ctx.Info("async", "i", i)
+	}
+	if err := ctx.Logger().Sync(); err != nil {
+		t.Fatal(err)
+	}
+	var b, _ = os.ReadFile(path)
+	if n := bytes.Count(b, []byte("\n")); n != 1000 {
+		t.Errorf("expect 1000 lines after sync, got %d", n)
+	}
+}
+
+// gatedWriter blocks every write until released
+type gatedWriter struct {
+	entered chan struct{}
+	release chan struct{}
+
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (w *gatedWriter) Write(p []byte) (int, error) {
+	w.entered <- struct{}{}
+	<-w.release
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.buf.Write(p)
+}
+
+func (w *gatedWriter) Sync() error { return nil }
+
+func (w *gatedWriter) String() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.buf.String()
+}
+
+func TestAsyncPolicy(t *testing.T) {
+	for _, tc := range []struct {
+		policy AsyncPolicy
+		expect string
+	}{
+		{AsyncDropNewest, "0,1,2,"},
+		{AsyncDropLow, "0,2,3,"},
+	} {
+		var w = &gatedWriter{entered: make(chan struct{}), release: make(chan struct{})}
+		var aw = newAsyncWriter(w, AsyncConfig{QueueSize: 2, BatchSize: 1, Policy: tc.policy})
+		var before = AsyncDropped()
+
+		aw.enqueue(zapcore.InfoLevel, []byte("0,"))
+		<-w.entered // writer is busy now
+		aw.enqueue(zapcore.InfoLevel, []byte("1,"))
+		aw.enqueue(zapcore.WarnLevel, []byte("2,"))
+		aw.enqueue(zapcore.ErrorLevel, []byte("3,"))
+		aw.enqueue(zapcore.InfoLevel, []byte("4,"))
+
+		var stop = make(chan struct{})
+		go func() {
+			for {
+				select {
+				case w.release <- struct{}{}:
+				case <-w.entered:
+				case <-stop:
+					return
+				}
+			}
+		}()
+		var err = aw.Sync()
+		close(stop)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := w.String(); got != tc.expect {
+			t.Errorf("policy %d: expect %q, got %q", tc.policy, tc.expect, got)
+		}
+		if n := AsyncDropped() - before; n != 2 {
+			t.Errorf("policy %d: expect 2 dropped, got %d", tc.policy, n)
+		}
+	}
+}
+
+func TestAsyncClose(t *testing.T) {
+	var path = filepath.Join(t.TempDir(), "close.log")
+	var logger, err = NewSimpleLogger("info", path, "json", true, WithAsync(AsyncConfig{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i++ {
+		logger.Info("async")
+	}
+	if err := CloseLogger(logger); err != nil {
+		t.Fatal(err)
+	}
+	var before = AsyncDropped()
+	logger.Info("after close")
+	if n := AsyncDropped() - before; n != 1 {
+		t.Errorf("logs after close should be dropped, got %d", n)
+	}
+	var b, _ = os.ReadFile(path)
+	if n := bytes.Count(b, []byte("\n")); n != 100 {
+		t.Errorf("expect 100 lines after close, got %d", n)
+	}
+	if err := CloseLogger(logger); err != nil {
+		t.Errorf("close twice should do nothing, got %v", err)
+	}
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) { return 0, errors.New("disk full") }
+func (failingWriter) Sync() error               { return nil }
+
+func TestAsyncWriteError(t *testing.T) {
+	var errOut bytes.Buffer
+	var aw = newAsyncWriter(failingWriter{}, AsyncConfig{})
+	aw.errOut = zapcore.AddSync(&errOut)
+	aw.enqueue(zapcore.InfoLevel, []byte("lost\n"))
+	if err := aw.Sync(); err == nil || err.Error() != "disk full" {
+		t.Errorf("write error should be returned by Sync, got %v", err)
+	}
+	if err := aw.Sync(); err != nil {
+		t.Errorf("write error should be returned only once, got %v", err)
+	}
+	if err := aw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(errOut.String(), "write error: disk full") {
+		t.Errorf("write error should be written to error output, got %q", errOut.String())
+	}
+}
+
+func TestAsyncDrainTimeout(t *testing.T) {
+	var w = &gatedWriter{entered: make(chan struct{}), release: make(chan struct{})}
+	var aw = newAsyncWriter(w, AsyncConfig{SyncTimeout: 10 * time.Millisecond})
+	aw.enqueue(zapcore.InfoLevel, []byte("0,"))
+	<-w.entered
+	if err := aw.Sync(); err == nil {
+		t.Fatalf("sync should time out while the writer is blocked")
+	}
+	w.release <- struct{}{}
+	if err := aw.Sync(); err != nil {
+		t.Fatalf("sync should succeed after the writer is released, got %v", err)
+	}
+	if err := aw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-aw.stopped:
+	default:
+		t.Errorf("loop should be stopped after close")
+	}
+}
@@ -0,0 +1,296 @@
+package xiao
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cjey/xiao/gerror"
+	"github.com/cjey/xiao/netkit"
+	"google.golang.org/grpc/codes"
+)
+
+// BreakerState 是熔断器的状态
+type BreakerState int
+
+const (
+	BreakerClosed BreakerState = iota
+	BreakerOpen
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	}
+	return "closed"
+}
+
+// BreakerConfig 定义了熔断器的参数，零值字段使用默认值
+type BreakerConfig struct {
+	// Window 统计失败比例的时间窗口，默认10s
+	Window time.Duration
+	// MinRequests 窗口内请求数达到此值后才会计算失败比例，默认20
+	MinRequests int
+	// FailureRatio 失败比例达到此值时熔断，默认0.5
+	FailureRatio float64
+	// OpenTimeout 熔断后经过此时间进入半开状态，默认5s
+	OpenTimeout time.Duration
+	// HalfOpenRequests 半开状态下允许通过的探测请求数，全部成功后恢复，默认1
+	HalfOpenRequests int
+}
+
+func (c BreakerConfig) withDefaults() BreakerConfig {
+	if c.Window <= 0 {
+		c.Window = 10 * time.Second
+	}
+	if c.MinRequests <= 0 {
+		c.MinRequests = 20
+	}
+	if c.FailureRatio <= 0 || c.FailureRatio > 1 {
+		c.FailureRatio = 0.5
+	}
+	if c.OpenTimeout <= 0 {
+		c.OpenTimeout = 5 * time.Second
+	}
+	if c.HalfOpenRequests <= 0 {
+		c.HalfOpenRequests = 1
+	}
+	return c
+}
+
+// ErrBreakerOpen 是熔断时返回的错误，它是grpc的Unavailable错误，因此Retry会对其重试
+var ErrBreakerOpen error = gerror.Grpc(gerror.GrpcUnavailable, "circuit breaker is open")
+
+// IsBreakerFailure 判断err是否计入熔断器的失败次数：
+// 只有grpc级别的错误才计入，业务错误、调用方自身导致的错误(如InvalidArgument)以及Canceled不计入
+func IsBreakerFailure(err error) bool {
+	if err == nil || errors.Is(err, Canceled) {
+		return false
+	}
+	if errors.Is(err, DeadlineExceeded) {
+		return true
+	}
+	var gerr = gerror.Decode(err)
+	if !gerr.IsGrpc() {
+		return false
+	}
+	switch codes.Code(-gerr.Code) {
+	case codes.Canceled, codes.InvalidArgument, codes.NotFound, codes.AlreadyExists,
+		codes.PermissionDenied, codes.Unauthenticated, codes.FailedPrecondition, codes.OutOfRange:
+		return false
+	}
+	return true
+}
+
+// Breaker 是一个上游地址的熔断器，包括closed、open、half-open三个状态
+type Breaker struct {
+	endpoint string
+	cfg      BreakerConfig
+	ctx      Context
+
+	mu          sync.Mutex
+	state       BreakerState
+	gen         uint64 // increased on every state change, results of older generations are ignored
+	windowStart time.Time
+	requests    int
+	failures    int
+	openedAt    time.Time
+	halfOpenAt  time.Time
+	probes      int
+	successes   int
+}
+
+// Endpoint 返回规范化后的上游地址
+func (b *Breaker) Endpoint() string {
+	return b.endpoint
+}
+
+// State 返回当前的状态，熔断时间已过时会返回half-open
+func (b *Breaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refresh(time.Now())
+	return b.state
+}
+
+// refresh 处理时间驱动的状态变化，需要持有锁
+func (b *Breaker) refresh(now time.Time) {
+	switch b.state {
+	case BreakerOpen:
+		if now.Sub(b.openedAt) >= b.cfg.OpenTimeout {
+			b.transit(BreakerHalfOpen, now)
+		}
+	case BreakerHalfOpen:
+		// probes that never report, e.g. lost done calls, expire after OpenTimeout
+		if b.probes >= b.cfg.HalfOpenRequests && now.Sub(b.halfOpenAt) >= b.cfg.OpenTimeout {
+			b.gen++
+			b.halfOpenAt, b.probes, b.successes = now, 0, 0
+		}
+	case BreakerClosed:
+		if now.Sub(b.windowStart) >= b.cfg.Window {
+			b.windowStart, b.requests, b.failures = now, 0, 0
+		}
+	}
+}
+
+// transit 切换状态并输出日志，需要持有锁
+func (b *Breaker) transit(to BreakerState, now time.Time) {
+	var from = b.state
+	b.state = to
+	b.gen++
+	switch to {
+	case BreakerOpen:
+		b.openedAt = now
+		b.ctx.Warn("circuit breaker state changed", "endpoint", b.endpoint, "from", from.String(), "to", to.String(),
+			"requests", b.requests, "failures", b.failures)
+	case BreakerHalfOpen:
+		b.halfOpenAt, b.probes, b.successes = now, 0, 0
+		b.ctx.Info("circuit breaker state changed", "endpoint", b.endpoint, "from", from.String(), "to", to.String())
+	case BreakerClosed:
+		b.windowStart, b.requests, b.failures = now, 0, 0
+		b.ctx.Info("circuit breaker state changed", "endpoint", b.endpoint, "from", from.String(), "to", to.String())
+	}
+}
+
+// Allow 判断是否允许发起请求，允许时返回的done必须在请求结束后以请求的错误调用一次；
+// 不允许时返回ErrBreakerOpen。状态在请求期间发生变化时，请求的结果会被忽略，
+// 例如在closed状态发起的慢请求不会被当作half-open状态的探测结果
+func (b *Breaker) Allow() (done func(err error), err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refresh(time.Now())
+	switch b.state {
+	case BreakerOpen:
+		return nil, ErrBreakerOpen
+	case BreakerHalfOpen:
+		if b.probes >= b.cfg.HalfOpenRequests {
+			return nil, ErrBreakerOpen
+		}
+		b.probes++
+	}
+	var gen = b.gen
+	var once sync.Once
+	return func(err error) {
+		once.Do(func() { b.report(gen, IsBreakerFailure(err)) })
+	}, nil
+}
+
+func (b *Breaker) report(gen uint64, failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var now = time.Now()
+	b.refresh(now)
+	if gen != b.gen {
+		return
+	}
+	switch b.state {
+	case BreakerClosed:
+		b.requests++
+		if failed {
+			b.failures++
+		}
+		if b.requests >= b.cfg.MinRequests && float64(b.failures) >= b.cfg.FailureRatio*float64(b.requests) {
+			b.transit(BreakerOpen, now)
+		}
+	case BreakerHalfOpen:
+		if failed {
+			b.transit(BreakerOpen, now)
+			return
+		}
+		if b.successes++; b.successes >= b.cfg.HalfOpenRequests {
+			b.transit(BreakerClosed, now)
+		}
+	}
+}
+
+// Do 在熔断器允许时执行fn，并以fn的返回值更新熔断器的状态，
+// fn发生panic时计为一次失败，然后继续抛出
+func (b *Breaker) Do(ctx Context, fn func(Context) error) (err error) {
+	done, err := b.Allow()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			done(gerror.Grpc(gerror.GrpcInternal, "panic: %v", p))
+			panic(p)
+		}
+		done(err)
+	}()
+	return fn(ctx)
+}
+
+// BreakerGroup 按照上游地址管理一组熔断器，地址使用netkit.NormalizeAddr规范化，
+// 状态变化通过名为CircuitBreaker的NamedContext输出日志
+type BreakerGroup struct {
+	cfg BreakerConfig
+	ctx Context
+
+	mu       sync.Mutex
+	breakers map[string]*Breaker
+}
+
+// NewBreakerGroup 返回一个使用cfg作为参数的BreakerGroup
+func NewBreakerGroup(cfg BreakerConfig) *BreakerGroup {
+	return &BreakerGroup{
+		cfg:      cfg.withDefaults(),
+		ctx:      NamedContext("CircuitBreaker"),
+		breakers: make(map[string]*Breaker),
+	}
+}
+
+// Get 返回endpoint对应的熔断器，不存在时创建
+func (g *BreakerGroup) Get(endpoint string) *Breaker {
+	var key = netkit.NormalizeAddr(endpoint, 0)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	var b, ok = g.breakers[key]
+	if !ok {
+		b = &Breaker{endpoint: key, cfg: g.cfg, ctx: g.ctx, windowStart: time.Now()}
+		g.breakers[key] = b
+	}
+	return b
+}
+
+// Do 使用endpoint对应的熔断器执行fn
+func (g *BreakerGroup) Do(ctx Context, endpoint string, fn func(Context) error) error {
+	return g.Get(endpoint).Do(ctx, fn)
+}
+
+// States 返回所有熔断器的当前状态
+func (g *BreakerGroup) States() map[string]BreakerState {
+	g.mu.Lock()
+	var breakers = make([]*Breaker, 0, len(g.breakers))
+	for _, b := range g.breakers {
+		breakers = append(breakers, b)
+	}
+	g.mu.Unlock()
+
+	var states = make(map[string]BreakerState, len(breakers))
+	for _, b := range breakers {
+		states[b.endpoint] = b.State()
+	}
+	return states
+}
+
+// Check 可以作为HealthCheck使用，存在熔断中的上游时返回错误
+func (g *BreakerGroup) Check(Context) error {
+	var open []string
+	for endpoint, state := range g.States() {
+		if state == BreakerOpen {
+			open = append(open, endpoint)
+		}
+	}
+	if len(open) > 0 {
+		slices.Sort(open)
+		return fmt.Errorf("circuit breaker is open: %s", strings.Join(open, ","))
+	}
+	return nil
+}
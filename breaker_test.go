@@ -0,0 +1,177 @@
+package xiao
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cjey/xiao/gerror"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/typepb"
+)
+
+func TestIsBreakerFailure(t *testing.T) {
+	for _, c := range []struct {
+		err    error
+		expect bool
+	}{
+		{nil, false},
+		{Canceled, false},
+		{DeadlineExceeded, true},
+		{errors.New("plain"), true},
+		{status.Error(codes.Unavailable, "down"), true},
+		{status.Error(codes.InvalidArgument, "bad"), false},
+		{gerror.Encode(typepb.Field_TYPE_STRING, "business"), false},
+	} {
+		if IsBreakerFailure(c.err) != c.expect {
+			t.Errorf("%v: expect %v", c.err, c.expect)
+		}
+	}
+}
+
+func TestBreaker(t *testing.T) {
+	var path = filepath.Join(t.TempDir(), "breaker.log")
+	var logger, err = NewSimpleLogger("info", path, "json", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ReplaceLogger(logger)()
+
+	var g = NewBreakerGroup(BreakerConfig{MinRequests: 4, OpenTimeout: 20 * time.Millisecond, HalfOpenRequests: 2})
+	var ctx = NamedContext("TestBreaker")
+	if g.Get("DNS:///Svc:080") != g.Get("svc:80") {
+		t.Fatalf("endpoints should be normalized")
+	}
+	var down = status.Error(codes.Unavailable, "down")
+	var business = gerror.Encode(typepb.Field_TYPE_STRING, "business")
+	var call = func(err error) error {
+		return g.Do(ctx, "svc:80", func(Context) error { return err })
+	}
+
+	// business errors do not count
+	for range 10 {
+		g.Do(ctx, "other:80", func(Context) error { return business })
+	}
+	if g.Get("other:80").State() != BreakerClosed || g.Check(ctx) != nil {
+		t.Fatalf("business errors should not open the breaker")
+	}
+
+	call(nil)
+	call(down)
+	call(down)
+	if call(down) != down {
+		t.Fatalf("unexpected result")
+	}
+	if g.States()["svc:80"] != BreakerOpen || call(nil) != ErrBreakerOpen {
+		t.Fatalf("breaker should be open: %v", g.States())
+	}
+	if err := g.Check(ctx); err == nil || err.Error() != "circuit breaker is open: svc:80" {
+		t.Errorf("unexpected check result: %v", err)
+	}
+	if !gerror.Decode(ErrBreakerOpen).Equal(codes.Unavailable) {
+		t.Errorf("ErrBreakerOpen should be grpc unavailable")
+	}
+
+	// half-open, a failed probe opens again
+	time.Sleep(20 * time.Millisecond)
+	if g.Get("svc:80").State() != BreakerHalfOpen {
+		t.Fatalf("breaker should be half-open")
+	}
+	call(down)
+	if g.Get("svc:80").State() != BreakerOpen {
+		t.Fatalf("failed probe should open the breaker")
+	}
+
+	// half-open, limited probes
+	time.Sleep(20 * time.Millisecond)
+	var b = g.Get("svc:80")
+	var done1, err1 = b.Allow()
+	var done2, err2 = b.Allow()
+	var _, err3 = b.Allow()
+	if err1 != nil || err2 != nil || err3 != ErrBreakerOpen {
+		t.Fatalf("unexpected probes: %v, %v, %v", err1, err2, err3)
+	}
+	done1(nil)
+	done1(down) // no effect
+	done2(nil)
+	if b.State() != BreakerClosed {
+		t.Fatalf("breaker should be closed after successful probes")
+	}
+
+	logger.Sync()
+	var logs, _ = os.ReadFile(path)
+	var lines = strings.Split(strings.TrimSpace(string(logs)), "\n")
+	var expect = []string{"closed open", "open half-open", "half-open open", "open half-open", "half-open closed"}
+	if len(lines) != len(expect) {
+		t.Fatalf("expect %d lines, got %d: %s", len(expect), len(lines), logs)
+	}
+	for i, e := range expect {
+		var fromTo = strings.Fields(e)
+		if !strings.Contains(lines[i], `"N":"CircuitBreaker","M":"circuit breaker state changed","endpoint":"svc:80","from":"`+fromTo[0]+`","to":"`+fromTo[1]+`"`) {
+			t.Errorf("unexpected log: %s", lines[i])
+		}
+	}
+}
+
+func TestBreakerPanicAndStale(t *testing.T) {
+	defer ReplaceLogger(zap.NewNop())()
+
+	var g = NewBreakerGroup(BreakerConfig{MinRequests: 2, OpenTimeout: 50 * time.Millisecond})
+	var ctx = NamedContext("TestBreakerPanicAndStale")
+	var b = g.Get("svc:80")
+	var down = status.Error(codes.Unavailable, "down")
+
+	// a slow request admitted while closed
+	var slow, _ = b.Allow()
+	b.Do(ctx, func(Context) error { return down })
+	b.Do(ctx, func(Context) error { return down })
+	if b.State() != BreakerOpen {
+		t.Fatalf("breaker should be open")
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	// a panicking probe counts as a failure and is re-panicked
+	func() {
+		defer func() {
+			if p := recover(); p != "boom" {
+				t.Errorf("panic should be re-panicked, got %v", p)
+			}
+		}()
+		b.Do(ctx, func(Context) error { panic("boom") })
+	}()
+	if b.State() != BreakerOpen {
+		t.Fatalf("panicking probe should open the breaker")
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	// the result of the slow request does not close the half-open breaker
+	var probe, err = b.Allow()
+	if err != nil {
+		t.Fatal(err)
+	}
+	slow(nil)
+	if b.State() != BreakerHalfOpen {
+		t.Fatalf("stale result should be ignored, got %s", b.State())
+	}
+
+	// a lost probe expires after OpenTimeout
+	if _, err := b.Allow(); err != ErrBreakerOpen {
+		t.Fatalf("probes should be limited")
+	}
+	time.Sleep(50 * time.Millisecond)
+	if err := b.Do(ctx, func(Context) error { return nil }); err != nil {
+		t.Fatalf("expired probe should be replaced, got %v", err)
+	}
+	if b.State() != BreakerClosed {
+		t.Fatalf("breaker should be closed, got %s", b.State())
+	}
+	probe(down) // result of the expired probe is ignored
+	if b.State() != BreakerClosed {
+		t.Fatalf("expired probe result should be ignored, got %s", b.State())
+	}
+}
@@ -0,0 +1,147 @@
+package xiao
+
+import (
+	gcontext "context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/cjey/xiao/gerror"
+)
+
+// Budget 描述如何从剩余的deadline中，为一次下游调用分配时间，
+// 计算方式为 remaining*Fraction - Margin，再限制在[Min, Max]之间
+type Budget struct {
+	// Fraction 分配剩余时间的比例，<= 0 或 > 1 时视为1
+	Fraction float64
+	// Margin 预留给自己的时间，比如用于处理下游返回的结果
+	Margin time.Duration
+	// Min 最少分配的时间，为0时不限制，即使超出剩余时间也会保证，此时实际上由上级的deadline生效
+	Min time.Duration
+	// Max 最多分配的时间，为0时不限制；没有deadline时，Max即为分配的时间
+	Max time.Duration
+}
+
+// Of 返回剩余时间为remaining时分配的时间，没有deadline时ok为false，此时返回Max
+func (b Budget) Of(remaining time.Duration, ok bool) time.Duration {
+	if !ok {
+		return b.Max
+	}
+	var d = remaining
+	if b.Fraction > 0 && b.Fraction < 1 {
+		d = time.Duration(float64(remaining) * b.Fraction)
+	}
+	d -= b.Margin
+	if b.Max > 0 && d > b.Max {
+		d = b.Max
+	}
+	if d < b.Min {
+		d = b.Min
+	}
+	return d
+}
+
+// Remaining 返回距离ctx的deadline还剩余的时间，没有deadline时ok为false
+func Remaining(ctx gcontext.Context) (remaining time.Duration, ok bool) {
+	var deadline time.Time
+	if deadline, ok = ctx.Deadline(); !ok {
+		return 0, false
+	}
+	return time.Until(deadline), true
+}
+
+// BudgetError 是因分配的时间耗尽而被取消时，Context的Cause()，
+// 它包装了DeadlineExceeded，因此errors.Is(err, DeadlineExceeded)成立
+type BudgetError struct {
+	// Budget 分配的时间
+	Budget time.Duration
+	// Remaining 分配时上级剩余的时间，上级没有deadline时为-1
+	Remaining time.Duration
+}
+
+func (e *BudgetError) Error() string {
+	if e.Remaining < 0 {
+		return fmt.Sprintf("deadline budget %s exceeded", e.Budget)
+	}
+	return fmt.Sprintf("deadline budget %s exceeded, %s remaining when allocated", e.Budget, e.Remaining)
+}
+
+func (e *BudgetError) Unwrap() error {
+	return DeadlineExceeded
+}
+
+// WithBudget 按照b从ctx剩余的时间中分配出一个子Context，
+// 分配的时间耗尽时，Cause()为*BudgetError，并会自动输出一条Warn日志，包含上级剩余的时间；
+// 上级的deadline先于分配的时间到期时，同样会输出这条日志，并带有parent_expired=true。
+// ctx没有deadline且b.Max为0时，不设置超时。
+func WithBudget(ctx Context, b Budget) (Context, CancelFunc) {
+	var remaining, ok = Remaining(ctx)
+	var d = b.Of(remaining, ok)
+	if !ok && d <= 0 {
+		return ctx.WithCancel()
+	}
+	return withBudget(ctx, d, remaining, ok)
+}
+
+// WithAttemptTimeout 为一次尝试分配attempt的时间，但不会超过ctx自身的deadline，
+// 超时时的行为与WithBudget相同
+func WithAttemptTimeout(ctx Context, attempt time.Duration) (Context, CancelFunc) {
+	var remaining, ok = Remaining(ctx)
+	var d = attempt
+	if ok && remaining < d {
+		d = remaining
+	}
+	return withBudget(ctx, d, remaining, ok)
+}
+
+func withBudget(ctx Context, d, remaining time.Duration, ok bool) (Context, CancelFunc) {
+	var cause = &BudgetError{Budget: d, Remaining: remaining}
+	if !ok {
+		cause.Remaining = -1
+	}
+	var newctx, cancel = ctx.WithTimeoutCause(d, cause)
+	var stop = newctx.AfterFunc(func() {
+		// the parent deadline may expire before the budget, e.g. WithAttemptTimeout limited by it
+		var byParent = newctx.Cause() != cause
+		if byParent && !errors.Is(ctx.Err(), DeadlineExceeded) {
+			// canceled by caller or parent
+			return
+		}
+		var kvs = []any{"budget", d}
+		if left, ok := Remaining(ctx); ok {
+			kvs = append(kvs, "parent_remaining", left)
+		}
+		if byParent {
+			kvs = append(kvs, "parent_expired", true, "cause", newctx.Cause())
+		}
+		newctx.Warn("deadline budget exceeded", kvs...)
+	})
+	return newctx, func() {
+		stop()
+		cancel()
+	}
+}
+
+// CheckTimeout 判断err是否为超时错误，包括DeadlineExceeded以及grpc的DeadlineExceeded，
+// 是则输出一条Warn日志，包含ctx剩余的时间以及分配的预算，用于区分是本地预算不足还是下游本身超时
+func CheckTimeout(ctx Context, err error) bool {
+	if err == nil {
+		return false
+	}
+	if !errors.Is(err, DeadlineExceeded) && !gerror.Decode(err).IsGrpcTimeout() {
+		return false
+	}
+
+	var kvs = []any{"err", err}
+	if remaining, ok := Remaining(ctx); ok {
+		kvs = append(kvs, "remaining", remaining, "local_expired", remaining <= 0)
+	} else {
+		kvs = append(kvs, "remaining", "unlimited")
+	}
+	var berr *BudgetError
+	if errors.As(ctx.Cause(), &berr) {
+		kvs = append(kvs, "budget", berr.Budget)
+	}
+	ctx.Warn("timeout", kvs...)
+	return true
+}
@@ -0,0 +1,133 @@
+package xiao
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestBudgetOf(t *testing.T) {
+	for _, c := range []struct {
+		b         Budget
+		remaining time.Duration
+		ok        bool
+		expect    time.Duration
+	}{
+		{Budget{}, time.Second, true, time.Second},
+		{Budget{Fraction: 0.5}, time.Second, true, 500 * time.Millisecond},
+		{Budget{Fraction: 0.5, Margin: 100 * time.Millisecond}, time.Second, true, 400 * time.Millisecond},
+		{Budget{Fraction: 0.1, Min: 200 * time.Millisecond}, time.Second, true, 200 * time.Millisecond},
+		{Budget{Max: 300 * time.Millisecond}, time.Second, true, 300 * time.Millisecond},
+		{Budget{Max: 300 * time.Millisecond}, 0, false, 300 * time.Millisecond},
+		{Budget{Fraction: 0.5}, 0, false, 0},
+	} {
+		if d := c.b.Of(c.remaining, c.ok); d != c.expect {
+			t.Errorf("%+v of %s: expect %s, got %s", c.b, c.remaining, c.expect, d)
+		}
+	}
+}
+
+func TestWithBudget(t *testing.T) {
+	var path = filepath.Join(t.TempDir(), "budget.log")
+	var logger, err = NewSimpleLogger("info", path, "json", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ReplaceLogger(logger)()
+
+	var ctx, cancel = NamedContext("TestWithBudget").WithTimeout(time.Second)
+	defer cancel()
+
+	var bctx, bcancel = WithBudget(ctx, Budget{Fraction: 0.5, Margin: 100 * time.Millisecond})
+	defer bcancel()
+	if remaining, ok := Remaining(bctx); !ok || remaining > 400*time.Millisecond || remaining < 300*time.Millisecond {
+		t.Errorf("unexpected budget: %s", remaining)
+	}
+
+	var actx, acancel = WithAttemptTimeout(ctx, 10*time.Millisecond)
+	defer acancel()
+	<-actx.Done()
+	var berr *BudgetError
+	if !errors.Is(actx.Cause(), DeadlineExceeded) || !errors.As(actx.Cause(), &berr) || berr.Budget != 10*time.Millisecond {
+		t.Errorf("unexpected cause: %v", actx.Cause())
+	}
+	if !CheckTimeout(actx, actx.Err()) || CheckTimeout(ctx, errors.New("other")) || CheckTimeout(ctx, nil) {
+		t.Errorf("unexpected CheckTimeout result")
+	}
+	if !CheckTimeout(ctx, status.Error(codes.DeadlineExceeded, "slow")) {
+		t.Errorf("grpc timeout should be detected")
+	}
+
+	// canceled by caller, no log
+	var cctx, ccancel = WithAttemptTimeout(ctx, time.Hour)
+	ccancel()
+	<-cctx.Done()
+
+	// without deadline
+	var nctx, ncancel = WithBudget(NamedContext("TestWithBudget"), Budget{Fraction: 0.5})
+	defer ncancel()
+	if _, ok := nctx.Deadline(); ok {
+		t.Errorf("no deadline expected")
+	}
+
+	// the budget log is written asynchronously by AfterFunc, wait for it
+	var b []byte
+	for deadline := time.Now().Add(time.Second); ; time.Sleep(time.Millisecond) {
+		logger.Sync()
+		if b, _ = os.ReadFile(path); strings.Contains(string(b), "deadline budget exceeded") {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("budget log not written: %s", b)
+		}
+	}
+	var lines = strings.Split(strings.TrimSpace(string(b)), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expect 3 lines, got %d: %s", len(lines), b)
+	}
+	var s = string(b)
+	if !strings.Contains(s, `"M":"deadline budget exceeded","budget":10000000,"parent_remaining":`) {
+		t.Errorf("missing budget log: %s", s)
+	}
+	if !strings.Contains(s, `"M":"timeout","err":{"error":"context deadline exceeded"}`) || !strings.Contains(s, `"local_expired":true,"budget":10000000}`) {
+		t.Errorf("missing timeout log: %s", s)
+	}
+	if !strings.Contains(s, `"grpc":4},"remaining":`) || !strings.Contains(s, `"local_expired":false}`) {
+		t.Errorf("missing grpc timeout log: %s", s)
+	}
+}
+
+func TestAttemptTimeoutParentExpired(t *testing.T) {
+	var path = filepath.Join(t.TempDir(), "budget.log")
+	var logger, err = NewSimpleLogger("info", path, "json", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ReplaceLogger(logger)()
+
+	var ctx, cancel = NamedContext("TestAttemptTimeoutParentExpired").WithTimeout(20 * time.Millisecond)
+	defer cancel()
+	var actx, acancel = WithAttemptTimeout(ctx, time.Hour)
+	defer acancel()
+	<-actx.Done()
+
+	var b []byte
+	for deadline := time.Now().Add(time.Second); ; time.Sleep(time.Millisecond) {
+		logger.Sync()
+		if b, _ = os.ReadFile(path); strings.Contains(string(b), "deadline budget exceeded") {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("budget log not written when the parent deadline expired: %s", b)
+		}
+	}
+	if s := string(b); !strings.Contains(s, `"parent_expired":true,"cause":{"error":"context deadline exceeded"}`) {
+		t.Errorf("unexpected budget log: %s", s)
+	}
+}
@@ -15,7 +15,8 @@ var (
 
 // type alias
 type (
-	CancelFunc = gcontext.CancelFunc
+	CancelFunc      = gcontext.CancelFunc
+	CancelCauseFunc = gcontext.CancelCauseFunc
 )
 
 // Context extend default context package, make it better
@@ -31,7 +32,7 @@ type Context interface {
 	// it should chain all locations start from root
 	At(location string) Context
 	ForkAt(location string) Context
-	// Reborn will use gcontext.Background() instead of internal context,
+	// Reborn is the same as WithoutCancel,
 	// it used for escaping internal context's cancel request
 	Reborn() Context
 	// RebornWith will use specified context instead of internal context,
@@ -41,12 +42,25 @@ type Context interface {
 	Name() string
 	// Location return my logger's location
 	Location() string
+	// End remove me and all my descendants from the registry,
+	// it does nothing if the registry is not in use
+	End()
 
 	// integrated base official context action
 	WithCancel() (Context, CancelFunc)
 	WithDeadline(time.Time) (Context, CancelFunc)
 	WithTimeout(time.Duration) (Context, CancelFunc)
 	WithValue(key, value any) Context
+	WithCancelCause() (Context, CancelCauseFunc)
+	WithDeadlineCause(time.Time, error) (Context, CancelFunc)
+	WithTimeoutCause(time.Duration, error) (Context, CancelFunc)
+	// WithoutCancel return a copied context which is not canceled when I am canceled,
+	// it keeps my values, name, location, env and logger
+	WithoutCancel() Context
+	// Cause return the cause of my cancellation, see gcontext.Cause
+	Cause() error
+	// AfterFunc arrange to call f in its own goroutine after I am done, see gcontext.AfterFunc
+	AfterFunc(f func()) (stop func() bool)
 
 	// Env return my env
 	// WARN: env value and official context value are two diffrent things
@@ -60,11 +74,25 @@ type Context interface {
 	GetFloat(key any) float64
 	GetBool(key any) bool
 
+	// StartSpan return a context at location name, and a span which is a child of
+	// my current span, the span should be ended by caller
+	StartSpan(name string) (Context, *Span)
+
+	// WithLevel return a forked context, which logs at the given minimum level,
+	// independent of the global logger, and it will be inherited by forks
+	WithLevel(level Level) Context
+
+	// Recover should be called directly by defer, it recovers the panic, logs the value and stack,
+	// and sets *errp to a grpc Internal *gerror.GError if errp is given
+	Recover(errp ...*error)
+
 	// mute/unmute my logger
 	Mute()
 	Unmute()
 	// Logger return my logger
 	Logger() Logger
+	// DebugEnabled return true if debug level will be written
+	DebugEnabled() bool
 	// shortcut methods of my logger
 	Debug(msg string, kvs ...any)
 	Debugf(template string, args ...any)
@@ -89,6 +117,9 @@ type context struct {
 
 	env    Env
 	logger Logger
+
+	// node in the registry, nil if not tracked
+	node *ctxNode
 }
 
 var _ Context = (*context)(nil)
@@ -188,7 +219,9 @@ func (ctx *context) Fork() Context {
 }
 
 func (ctx *context) At(location string) Context {
-	return ctx.fork("", location)
+	var newctx = ctx.fork("", location)
+	ctx.child(newctx)
+	return newctx
 }
 
 func (ctx *context) ForkAt(location string) Context {
@@ -196,11 +229,12 @@ func (ctx *context) ForkAt(location string) Context {
 	var newctx = ctx.fork(strconv.FormatUint(seq, 10), location)
 	var tracker uint64
 	newctx.tracker = &tracker
+	ctx.child(newctx)
 	return newctx
 }
 
 func (ctx *context) Reborn() Context {
-	return ctx.RebornWith(gcontext.Background())
+	return ctx.WithoutCancel()
 }
 
 func (ctx *context) RebornWith(gctx gcontext.Context) Context {
@@ -209,6 +243,7 @@ func (ctx *context) RebornWith(gctx gcontext.Context) Context {
 	}
 	var newctx = ctx.fork("", "")
 	newctx.gctx = gctx
+	ctx.detach(newctx)
 	return newctx
 }
 
@@ -220,10 +255,15 @@ func (ctx *context) Location() string {
 	return ctx.logger.Location()
 }
 
+func (ctx *context) End() {
+	ctx.node.end()
+}
+
 func (ctx *context) WithCancel() (Context, CancelFunc) {
 	var newctx = ctx.fork("", "")
 	var newgctx, f = gcontext.WithCancel(newctx.gctx)
 	newctx.gctx = newgctx
+	ctx.child(newctx)
 	return newctx, f
 }
 
@@ -231,6 +271,7 @@ func (ctx *context) WithDeadline(d time.Time) (Context, CancelFunc) {
 	var newctx = ctx.fork("", "")
 	var newgctx, f = gcontext.WithDeadline(newctx.gctx, d)
 	newctx.gctx = newgctx
+	ctx.child(newctx)
 	return newctx, f
 }
 
@@ -238,15 +279,75 @@ func (ctx *context) WithTimeout(timeout time.Duration) (Context, CancelFunc) {
 	var newctx = ctx.fork("", "")
 	var newgctx, f = gcontext.WithTimeout(newctx.gctx, timeout)
 	newctx.gctx = newgctx
+	ctx.child(newctx)
+	return newctx, f
+}
+
+func (ctx *context) WithCancelCause() (Context, CancelCauseFunc) {
+	var newctx = ctx.fork("", "")
+	var newgctx, f = gcontext.WithCancelCause(newctx.gctx)
+	newctx.gctx = newgctx
+	ctx.child(newctx)
+	return newctx, f
+}
+
+func (ctx *context) WithDeadlineCause(d time.Time, cause error) (Context, CancelFunc) {
+	var newctx = ctx.fork("", "")
+	var newgctx, f = gcontext.WithDeadlineCause(newctx.gctx, d, cause)
+	newctx.gctx = newgctx
+	ctx.child(newctx)
 	return newctx, f
 }
 
+func (ctx *context) WithTimeoutCause(timeout time.Duration, cause error) (Context, CancelFunc) {
+	var newctx = ctx.fork("", "")
+	var newgctx, f = gcontext.WithTimeoutCause(newctx.gctx, timeout, cause)
+	newctx.gctx = newgctx
+	ctx.child(newctx)
+	return newctx, f
+}
+
+func (ctx *context) WithoutCancel() Context {
+	return ctx.RebornWith(gcontext.WithoutCancel(ctx.gctx))
+}
+
+func (ctx *context) Cause() error {
+	return gcontext.Cause(ctx.gctx)
+}
+
+func (ctx *context) AfterFunc(f func()) (stop func() bool) {
+	return gcontext.AfterFunc(ctx.gctx, f)
+}
+
 func (ctx *context) WithValue(key, value any) Context {
 	var newctx = ctx.fork("", "")
 	newctx.gctx = gcontext.WithValue(newctx.gctx, key, value)
+	ctx.share(newctx)
 	return newctx
 }
 
+func (ctx *context) WithLevel(level Level) Context {
+	var newctx = ctx.fork("", "")
+	newctx.logger = ctx.logger.WithLevel(level)
+	ctx.share(newctx)
+	return newctx
+}
+
+func (ctx *context) StartSpan(name string) (Context, *Span) {
+	return startSpan(ctx, name)
+}
+
+func (ctx *context) Recover(errp ...*error) {
+	if p := recover(); p != nil {
+		var err = recovered(ctx, p)
+		for _, e := range errp {
+			if e != nil {
+				*e = err
+			}
+		}
+	}
+}
+
 func (ctx *context) Env() Env {
 	return ctx.env
 }
@@ -264,6 +365,10 @@ func (ctx *context) Logger() Logger {
 	return ctx.logger
 }
 
+func (ctx *context) DebugEnabled() bool {
+	return ctx.logger.Enabled(DebugLevel)
+}
+
 func (ctx *context) Set(key, value any) {
 	ctx.env.Set(key, value)
 }
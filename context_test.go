@@ -2,7 +2,13 @@ package xiao
 
 import (
 	gcontext "context"
+	"errors"
 	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
 )
 
 func TestSessionalContext(t *testing.T) {
@@ -53,3 +59,66 @@ func TestSession(t *testing.T) {
 		ctx.Fatal("fail", "origin", session, "got", got)
 	}
 }
+
+func TestWithLevel(t *testing.T) {
+	var core, logs = observer.New(zapcore.InfoLevel)
+	defer ReplaceLogger(zap.New(core))()
+
+	var ctx = NamedContext("TestWithLevel")
+	var dctx = ctx.WithLevel(DebugLevel)
+	ctx.Debug("global")
+	dctx.Debug("override")
+	dctx.ForkAt("child").Debug("inherited")
+	dctx.WithLevel(WarnLevel).Info("raised")
+
+	var got = logs.TakeAll()
+	if len(got) != 2 || got[0].Message != "override" || got[1].Message != "inherited" {
+		t.Fatalf("unexpected entries: %v", got)
+	}
+	if got[1].LoggerName != "TestWithLevel.1" || got[1].ContextMap()["@"] != "child" {
+		t.Errorf("fork should keep name and location: %v", got[1])
+	}
+	if got[0].Level != DebugLevel {
+		t.Errorf("entries should keep their own level, got %s", got[0].Level)
+	}
+	if !dctx.Logger().Enabled(DebugLevel) || ctx.Logger().Enabled(DebugLevel) {
+		t.Errorf("Enabled should respect the override")
+	}
+}
+
+func TestCancelCause(t *testing.T) {
+	var errShutdown = errors.New("shutdown")
+	var ctx = NamedContext("TestCancelCause").At("Root")
+	ctx.Set("k", "v")
+
+	var cctx, cancel = ctx.WithCancelCause()
+	var called = make(chan struct{})
+	cctx.AfterFunc(func() { close(called) })
+	var detached = cctx.WithValue("key", "value").WithoutCancel()
+	var reborn = cctx.Reborn()
+	cancel(errShutdown)
+	<-called
+
+	if cctx.Err() != Canceled || cctx.Cause() != errShutdown {
+		t.Errorf("unexpected cause: %v, %v", cctx.Err(), cctx.Cause())
+	}
+	if detached.Err() != nil || reborn.Err() != nil || detached.Cause() != nil {
+		t.Errorf("detached context should not be canceled")
+	}
+	if detached.Value("key") != "value" || detached.GetString("k") != "v" ||
+		detached.Name() != "TestCancelCause" || detached.Location() != "Root" {
+		t.Errorf("detached context should keep values, env, name and location")
+	}
+
+	var tctx, tcancel = ctx.WithTimeoutCause(time.Millisecond, errShutdown)
+	defer tcancel()
+	<-tctx.Done()
+	if tctx.Err() != DeadlineExceeded || tctx.Cause() != errShutdown {
+		t.Errorf("unexpected timeout cause: %v, %v", tctx.Err(), tctx.Cause())
+	}
+	var dctx, dcancel = ctx.WithDeadlineCause(time.Now().Add(time.Hour), errShutdown)
+	dcancel()
+	if dctx.Cause() != Canceled {
+		t.Errorf("manual cancel should use Canceled as cause: %v", dctx.Cause())
+	}
+}
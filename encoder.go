@@ -0,0 +1,393 @@
+package xiao
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/buffer"
+	"go.uber.org/zap/zapcore"
+)
+
+// 额外注册的编码方式，可以直接用于NewSimpleLogger和SinkConfig的encoding参数
+const (
+	// EncodingLogfmt 输出logfmt格式，名称和位置紧跟在等级之后，例如
+	// T="2020-04-11 21:24:45.361" L=info N=ZookeeperMonitor @=GetID M="got it!" id=123
+	EncodingLogfmt = "logfmt"
+	// EncodingColorConsole 在console格式的基础上对等级、名称和位置进行着色，位置会被前置到消息之前，
+	// 当输出的目标不是终端时，会自动退化为console格式
+	EncodingColorConsole = "color-console"
+)
+
+func init() {
+	if err := zap.RegisterEncoder(EncodingLogfmt, func(cfg zapcore.EncoderConfig) (zapcore.Encoder, error) {
+		return newLogfmtEncoder(cfg), nil
+	}); err != nil {
+		panic(err)
+	}
+	if err := zap.RegisterEncoder(EncodingColorConsole, func(cfg zapcore.EncoderConfig) (zapcore.Encoder, error) {
+		return newColorConsoleEncoder(cfg), nil
+	}); err != nil {
+		panic(err)
+	}
+}
+
+// newEncoder 按名称生成内置支持的编码器，用于需要自行构建zapcore.Core的场景
+func newEncoder(encoding string, cfg zapcore.EncoderConfig) (zapcore.Encoder, error) {
+	switch encoding {
+	case "console":
+		return zapcore.NewConsoleEncoder(cfg), nil
+	case "json":
+		return zapcore.NewJSONEncoder(cfg), nil
+	case EncodingLogfmt:
+		return newLogfmtEncoder(cfg), nil
+	case EncodingColorConsole:
+		return newColorConsoleEncoder(cfg), nil
+	default:
+		return nil, fmt.Errorf("unsupported encoding %q", encoding)
+	}
+}
+
+// isTerminal 判断给定的输出路径是否为终端，设置了NO_COLOR环境变量时总是返回false
+func isTerminal(path string) bool {
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	var f *os.File
+	switch path {
+	case "stderr":
+		f = os.Stderr
+	case "stdout":
+		f = os.Stdout
+	default:
+		return false
+	}
+	var info, err = f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+const (
+	_ANSI_RESET = "\x1b[0m"
+	_ANSI_BOLD  = "\x1b[1m"
+	_ANSI_CYAN  = "\x1b[36m"
+)
+
+// colorConsoleEncoder 拦截'@'位置字段，并将其着色后前置到消息之前
+type colorConsoleEncoder struct {
+	zapcore.Encoder
+	location string
+}
+
+func newColorConsoleEncoder(cfg zapcore.EncoderConfig) zapcore.Encoder {
+	cfg.EncodeLevel = zapcore.LowercaseColorLevelEncoder
+	cfg.EncodeName = func(name string, enc zapcore.PrimitiveArrayEncoder) {
+		enc.AppendString(_ANSI_BOLD + name + _ANSI_RESET)
+	}
+	return &colorConsoleEncoder{Encoder: zapcore.NewConsoleEncoder(cfg)}
+}
+
+func (e *colorConsoleEncoder) AddString(key, value string) {
+	if key == locationKey {
+		e.location = value
+		return
+	}
+	e.Encoder.AddString(key, value)
+}
+
+func (e *colorConsoleEncoder) Clone() zapcore.Encoder {
+	return &colorConsoleEncoder{Encoder: e.Encoder.Clone(), location: e.location}
+}
+
+func (e *colorConsoleEncoder) EncodeEntry(ent zapcore.Entry, fields []zapcore.Field) (*buffer.Buffer, error) {
+	var location = e.location
+	for i := range fields {
+		if fields[i].Key == locationKey && fields[i].Type == zapcore.StringType {
+			location = fields[i].String
+			fields = append(fields[:i:i], fields[i+1:]...)
+			break
+		}
+	}
+	if location != "" {
+		ent.Message = _ANSI_CYAN + locationKey + location + _ANSI_RESET + " " + ent.Message
+	}
+	return e.Encoder.EncodeEntry(ent, fields)
+}
+
+var _logfmtPool = buffer.NewPool()
+
+// logfmtEncoder 输出logfmt格式，复杂类型的值会以json编码后作为字符串输出
+type logfmtEncoder struct {
+	cfg        *zapcore.EncoderConfig
+	buf        *buffer.Buffer
+	namespaces []string
+	location   string
+}
+
+func newLogfmtEncoder(cfg zapcore.EncoderConfig) zapcore.Encoder {
+	return &logfmtEncoder{cfg: &cfg, buf: _logfmtPool.Get()}
+}
+
+func (e *logfmtEncoder) clone() *logfmtEncoder {
+	var e2 = &logfmtEncoder{
+		cfg:        e.cfg,
+		buf:        _logfmtPool.Get(),
+		namespaces: e.namespaces[:len(e.namespaces):len(e.namespaces)],
+		location:   e.location,
+	}
+	e2.buf.Write(e.buf.Bytes())
+	return e2
+}
+
+func (e *logfmtEncoder) Clone() zapcore.Encoder {
+	return e.clone()
+}
+
+func (e *logfmtEncoder) key(key string) {
+	if e.buf.Len() > 0 {
+		e.buf.AppendByte(' ')
+	}
+	for _, ns := range e.namespaces {
+		e.buf.AppendString(ns)
+		e.buf.AppendByte('.')
+	}
+	e.buf.AppendString(key)
+	e.buf.AppendByte('=')
+}
+
+func (e *logfmtEncoder) value(s string) {
+	appendLogfmtValue(e.buf, s)
+}
+
+func appendLogfmtValue(buf *buffer.Buffer, s string) {
+	if s == "" {
+		buf.AppendString(`""`)
+		return
+	}
+	for _, r := range s {
+		if r <= ' ' || r == '=' || r == '"' || r == utf8.RuneError || r == 0x7f {
+			buf.AppendString(strconv.Quote(s))
+			return
+		}
+	}
+	buf.AppendString(s)
+}
+
+// encodePrimitive 调用EncoderConfig中的编码函数，并将结果合并为一个字符串
+func encodePrimitive(f func(zapcore.PrimitiveArrayEncoder)) string {
+	var m = zapcore.NewMapObjectEncoder()
+	m.AddArray("v", zapcore.ArrayMarshalerFunc(func(enc zapcore.ArrayEncoder) error {
+		f(enc)
+		return nil
+	}))
+	var vals, _ = m.Fields["v"].([]any)
+	var parts = make([]string, 0, len(vals))
+	for _, v := range vals {
+		parts = append(parts, fmt.Sprint(v))
+	}
+	return strings.Join(parts, " ")
+}
+
+func (e *logfmtEncoder) addJSON(key string, v any) error {
+	var b, err = json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	e.key(key)
+	e.value(string(b))
+	return nil
+}
+
+func (e *logfmtEncoder) AddArray(key string, arr zapcore.ArrayMarshaler) error {
+	var m = zapcore.NewMapObjectEncoder()
+	if err := m.AddArray(key, arr); err != nil {
+		return err
+	}
+	return e.addJSON(key, m.Fields[key])
+}
+
+func (e *logfmtEncoder) AddObject(key string, obj zapcore.ObjectMarshaler) error {
+	var m = zapcore.NewMapObjectEncoder()
+	if err := m.AddObject(key, obj); err != nil {
+		return err
+	}
+	return e.addJSON(key, m.Fields[key])
+}
+
+func (e *logfmtEncoder) AddBinary(key string, value []byte) {
+	e.AddString(key, base64.StdEncoding.EncodeToString(value))
+}
+
+func (e *logfmtEncoder) AddByteString(key string, value []byte) {
+	e.AddString(key, string(value))
+}
+
+func (e *logfmtEncoder) AddBool(key string, value bool) {
+	e.key(key)
+	e.buf.AppendBool(value)
+}
+
+func (e *logfmtEncoder) AddComplex128(key string, value complex128) {
+	e.key(key)
+	e.buf.AppendString(strconv.FormatComplex(value, 'f', -1, 128))
+}
+
+func (e *logfmtEncoder) AddComplex64(key string, value complex64) {
+	e.key(key)
+	e.buf.AppendString(strconv.FormatComplex(complex128(value), 'f', -1, 64))
+}
+
+func (e *logfmtEncoder) AddDuration(key string, value time.Duration) {
+	if e.cfg.EncodeDuration == nil {
+		e.AddInt64(key, int64(value))
+		return
+	}
+	e.key(key)
+	e.value(encodePrimitive(func(enc zapcore.PrimitiveArrayEncoder) {
+		e.cfg.EncodeDuration(value, enc)
+	}))
+}
+
+func (e *logfmtEncoder) AddFloat64(key string, value float64) {
+	e.key(key)
+	switch {
+	case math.IsNaN(value):
+		e.buf.AppendString("NaN")
+	case math.IsInf(value, 1):
+		e.buf.AppendString("+Inf")
+	case math.IsInf(value, -1):
+		e.buf.AppendString("-Inf")
+	default:
+		e.buf.AppendFloat(value, 64)
+	}
+}
+
+func (e *logfmtEncoder) AddFloat32(key string, value float32) {
+	e.AddFloat64(key, float64(value))
+}
+
+func (e *logfmtEncoder) AddInt(key string, value int)     { e.AddInt64(key, int64(value)) }
+func (e *logfmtEncoder) AddInt32(key string, value int32) { e.AddInt64(key, int64(value)) }
+func (e *logfmtEncoder) AddInt16(key string, value int16) { e.AddInt64(key, int64(value)) }
+func (e *logfmtEncoder) AddInt8(key string, value int8)   { e.AddInt64(key, int64(value)) }
+
+func (e *logfmtEncoder) AddInt64(key string, value int64) {
+	e.key(key)
+	e.buf.AppendInt(value)
+}
+
+func (e *logfmtEncoder) AddString(key, value string) {
+	if key == locationKey && len(e.namespaces) == 0 {
+		e.location = value
+		return
+	}
+	e.key(key)
+	e.value(value)
+}
+
+func (e *logfmtEncoder) AddTime(key string, value time.Time) {
+	if e.cfg.EncodeTime == nil {
+		e.AddInt64(key, value.UnixNano())
+		return
+	}
+	e.key(key)
+	e.value(encodePrimitive(func(enc zapcore.PrimitiveArrayEncoder) {
+		e.cfg.EncodeTime(value, enc)
+	}))
+}
+
+func (e *logfmtEncoder) AddUint(key string, value uint)       { e.AddUint64(key, uint64(value)) }
+func (e *logfmtEncoder) AddUint32(key string, value uint32)   { e.AddUint64(key, uint64(value)) }
+func (e *logfmtEncoder) AddUint16(key string, value uint16)   { e.AddUint64(key, uint64(value)) }
+func (e *logfmtEncoder) AddUint8(key string, value uint8)     { e.AddUint64(key, uint64(value)) }
+func (e *logfmtEncoder) AddUintptr(key string, value uintptr) { e.AddUint64(key, uint64(value)) }
+
+func (e *logfmtEncoder) AddUint64(key string, value uint64) {
+	e.key(key)
+	e.buf.AppendUint(value)
+}
+
+func (e *logfmtEncoder) AddReflected(key string, value any) error {
+	return e.addJSON(key, value)
+}
+
+func (e *logfmtEncoder) OpenNamespace(key string) {
+	e.namespaces = append(e.namespaces, key)
+}
+
+func (e *logfmtEncoder) EncodeEntry(ent zapcore.Entry, fields []zapcore.Field) (*buffer.Buffer, error) {
+	var final = e.clone()
+	defer final.buf.Free()
+	for i := range fields {
+		fields[i].AddTo(final)
+	}
+
+	var line = _logfmtPool.Get()
+	var header = func(key, value string) {
+		if line.Len() > 0 {
+			line.AppendByte(' ')
+		}
+		line.AppendString(key)
+		line.AppendByte('=')
+		appendLogfmtValue(line, value)
+	}
+
+	var cfg = e.cfg
+	if cfg.TimeKey != "" && cfg.EncodeTime != nil {
+		header(cfg.TimeKey, encodePrimitive(func(enc zapcore.PrimitiveArrayEncoder) {
+			cfg.EncodeTime(ent.Time, enc)
+		}))
+	}
+	if cfg.LevelKey != "" && cfg.EncodeLevel != nil {
+		header(cfg.LevelKey, encodePrimitive(func(enc zapcore.PrimitiveArrayEncoder) {
+			cfg.EncodeLevel(ent.Level, enc)
+		}))
+	}
+	if cfg.NameKey != "" && ent.LoggerName != "" {
+		var name = ent.LoggerName
+		if cfg.EncodeName != nil {
+			name = encodePrimitive(func(enc zapcore.PrimitiveArrayEncoder) {
+				cfg.EncodeName(ent.LoggerName, enc)
+			})
+		}
+		header(cfg.NameKey, name)
+	}
+	if final.location != "" {
+		header(locationKey, final.location)
+	}
+	if cfg.MessageKey != "" {
+		header(cfg.MessageKey, ent.Message)
+	}
+	if cfg.CallerKey != "" && ent.Caller.Defined && cfg.EncodeCaller != nil {
+		header(cfg.CallerKey, encodePrimitive(func(enc zapcore.PrimitiveArrayEncoder) {
+			cfg.EncodeCaller(ent.Caller, enc)
+		}))
+	}
+	if cfg.FunctionKey != "" && ent.Caller.Defined {
+		header(cfg.FunctionKey, ent.Caller.Function)
+	}
+	if final.buf.Len() > 0 {
+		if line.Len() > 0 {
+			line.AppendByte(' ')
+		}
+		line.Write(final.buf.Bytes())
+	}
+	if cfg.StacktraceKey != "" && ent.Stack != "" {
+		header(cfg.StacktraceKey, ent.Stack)
+	}
+	if cfg.SkipLineEnding {
+		return line, nil
+	}
+	if cfg.LineEnding != "" {
+		line.AppendString(cfg.LineEnding)
+	} else {
+		line.AppendString(zapcore.DefaultLineEnding)
+	}
+	return line, nil
+}
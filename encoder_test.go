@@ -0,0 +1,65 @@
+package xiao
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestLogfmtEncoder(t *testing.T) {
+	var path = filepath.Join(t.TempDir(), "logfmt.log")
+	var logger, err = NewSimpleLogger("info", path, EncodingLogfmt, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ReplaceLogger(logger)()
+
+	NamedContext("TestLogfmt").At("GetID").Info("got it!", "id", 123, "user", "cjey hou", "tags", []string{"a", "b"})
+	logger.Sync()
+
+	var b, _ = os.ReadFile(path)
+	var line = strings.TrimSpace(string(b))
+	if !strings.Contains(line, ` L=info N=TestLogfmt @=GetID M="got it!" id=123 user="cjey hou" tags="[\"a\",\"b\"]"`) {
+		t.Errorf("unexpected logfmt line: %s", line)
+	}
+	if !strings.HasPrefix(line, `T="`) {
+		t.Errorf("logfmt line should start with time: %s", line)
+	}
+}
+
+func TestColorConsoleEncoder(t *testing.T) {
+	var enc = newColorConsoleEncoder(simpleEncoderConfig())
+	enc.AddString(locationKey, "GetID")
+	var buf, err = enc.EncodeEntry(zapcore.Entry{
+		Level:      zapcore.WarnLevel,
+		Time:       time.Now(),
+		LoggerName: "TestColor",
+		Message:    "colored",
+	}, []zapcore.Field{zap.String("id", "123")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var line = buf.String()
+	if !strings.Contains(line, _ANSI_BOLD+"TestColor"+_ANSI_RESET) ||
+		!strings.Contains(line, _ANSI_CYAN+"@GetID"+_ANSI_RESET+" colored") ||
+		strings.Contains(line, `"@"`) || !strings.Contains(line, `"id": "123"`) {
+		t.Errorf("unexpected color console line: %q", line)
+	}
+
+	// not a terminal, fallback to console
+	var path = filepath.Join(t.TempDir(), "color.log")
+	logger, err := NewSimpleLogger("info", path, EncodingColorConsole, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger.Info("plain")
+	logger.Sync()
+	if b, _ := os.ReadFile(path); strings.Contains(string(b), "\x1b[") {
+		t.Errorf("color should be disabled for files: %q", b)
+	}
+}
@@ -0,0 +1,170 @@
+package xiao
+
+import (
+	"errors"
+	"reflect"
+	"sync/atomic"
+
+	"github.com/cjey/xiao/gerror"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"google.golang.org/grpc/status"
+)
+
+// ErrorKey 是kvs中单独出现的error值所使用的key，例如
+// ctx.Error("query failed", err) 等价于 ctx.Error("query failed", "err", err)
+const ErrorKey = "err"
+
+// 错误原因链的最大深度，避免循环引用
+const _MAX_ERROR_CAUSES = 32
+
+var _errorStacktrace atomic.Bool
+
+// SetErrorStacktrace 设置输出Error及以上等级，并且kvs中包含error值的日志时，是否附带调用栈
+func SetErrorStacktrace(enabled bool) {
+	_errorStacktrace.Store(enabled)
+}
+
+// errorField 将error结构化输出。
+// *gerror.GError以及grpc status错误会输出code/name/message，grpc错误额外输出grpc状态码，
+// 捕获了调用栈的*gerror.GError还会输出stack(参见gerror.SetCaptureStack)；
+// 包装过的错误会输出causes原因链。
+type errorField struct {
+	err error
+}
+
+func (f errorField) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	if isNilError(f.err) {
+		enc.AddString("error", "<nil>")
+		return nil
+	}
+	var gerr *gerror.GError
+	if _, ok := f.err.(*gerror.GError); !ok {
+		enc.AddString("error", f.err.Error())
+	}
+	if errors.As(f.err, &gerr) && gerr != nil {
+		addGError(enc, gerr)
+	} else if _, ok := status.FromError(f.err); ok {
+		addGError(enc, gerror.Decode(f.err))
+	}
+
+	if causes := errorCauses(f.err); len(causes) > 0 {
+		return enc.AddArray("causes", zapcore.ArrayMarshalerFunc(func(arr zapcore.ArrayEncoder) error {
+			for _, cause := range causes {
+				arr.AppendString(cause)
+			}
+			return nil
+		}))
+	}
+	return nil
+}
+
+func addGError(enc zapcore.ObjectEncoder, gerr *gerror.GError) {
+	enc.AddInt32("code", gerr.Code)
+	enc.AddString("name", gerr.Name)
+	enc.AddString("message", gerr.Message)
+	if gerr.IsGrpc() {
+		enc.AddUint32("grpc", uint32(-gerr.Code))
+	}
+	if stack := gerr.Stack(); stack != "" {
+		enc.AddString("stack", stack)
+	}
+}
+
+// isNilError 判断err是否为nil，包括值为nil指针的error，例如 error((*gerror.GError)(nil))
+func isNilError(err error) bool {
+	if err == nil {
+		return true
+	}
+	switch v := reflect.ValueOf(err); v.Kind() {
+	case reflect.Pointer, reflect.Map, reflect.Slice, reflect.Func, reflect.Chan, reflect.Interface:
+		return v.IsNil()
+	}
+	return false
+}
+
+// errorCauses 按深度优先的顺序返回被包装的所有错误
+func errorCauses(err error) []string {
+	var causes []string
+	var walk func(error)
+	walk = func(e error) {
+		if len(causes) >= _MAX_ERROR_CAUSES {
+			return
+		}
+		switch x := e.(type) {
+		case interface{ Unwrap() error }:
+			if c := x.Unwrap(); c != nil {
+				causes = append(causes, c.Error())
+				walk(c)
+			}
+		case interface{ Unwrap() []error }:
+			for _, c := range x.Unwrap() {
+				if c != nil {
+					causes = append(causes, c.Error())
+					walk(c)
+				}
+			}
+		}
+	}
+	walk(err)
+	return causes
+}
+
+// errorKVs 将kvs中的error值转换为结构化输出，只在有改动时才会复制，
+// found表示是否包含非nil的error值。值为nil指针的error保持原样，由zap输出<nil>
+func errorKVs(kvs []any) (_ []any, found bool) {
+	var (
+		out     []any
+		changed bool
+		keep    = func(i int) {
+			if changed {
+				out = append(out, kvs[i])
+			}
+		}
+		change = func(i int, vals ...any) {
+			if !changed {
+				changed = true
+				out = make([]any, 0, len(kvs)+2)
+				out = append(out, kvs[:i]...)
+			}
+			out = append(out, vals...)
+		}
+	)
+
+	for i := 0; i < len(kvs); i++ {
+		switch v := kvs[i].(type) {
+		case zapcore.Field:
+			if err, ok := v.Interface.(error); ok && v.Type == zapcore.ErrorType && !isNilError(err) {
+				change(i, zap.Object(v.Key, errorField{err}))
+				found = true
+			} else {
+				keep(i)
+			}
+		case error:
+			// single error without key
+			if isNilError(v) {
+				change(i, ErrorKey, v)
+			} else {
+				change(i, ErrorKey, errorField{v})
+				found = true
+			}
+		default:
+			keep(i)
+			if i+1 >= len(kvs) {
+				break
+			}
+			i++
+			if err, ok := kvs[i].(error); ok && !isNilError(err) {
+				change(i, errorField{err})
+				found = true
+			} else {
+				keep(i)
+			}
+		}
+	}
+
+	if !changed {
+		return kvs, false
+	}
+	return out, found
+}
@@ -0,0 +1,138 @@
+package xiao
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cjey/xiao/gerror"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/typepb"
+)
+
+func TestErrorField(t *testing.T) {
+	var path = filepath.Join(t.TempDir(), "errfield.log")
+	var logger, err = NewSimpleLogger("info", path, "json", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ReplaceLogger(logger)()
+
+	var ctx = NamedContext("TestErrorField")
+	var gerr = gerror.New(typepb.Field_TYPE_STRING, "bad %s", "input")
+	var wrapped = fmt.Errorf("load: %w", gerr)
+	var joined = errors.Join(errors.New("first"), fmt.Errorf("second: %w", os.ErrNotExist))
+
+	ctx.Warn("gerror", "err", gerr)
+	ctx.Warn("wrapped", wrapped)
+	ctx.Warn("grpc", "error", status.Error(codes.NotFound, "no such user"))
+	ctx.Warn("joined", zap.Error(joined))
+	ctx.Warn("plain", "x", 1, "n", nil)
+	logger.Sync()
+
+	var b, _ = os.ReadFile(path)
+	var lines = strings.Split(strings.TrimSpace(string(b)), "\n")
+	if len(lines) != 5 {
+		t.Fatalf("expect 5 lines, got %d: %s", len(lines), b)
+	}
+	for i, expect := range []string{
+		`"err":{"code":9,"name":"TYPE_STRING","message":"bad input"}`,
+		`"err":{"error":"load: TYPE_STRING[9]: bad input","code":9,"name":"TYPE_STRING","message":"bad input","causes":["TYPE_STRING[9]: bad input"]}`,
+		`"error":{"error":"rpc error: code = NotFound desc = no such user","code":-5,"name":"NotFound","message":"no such user","grpc":5}`,
+		`"error":{"error":"first\nsecond: file does not exist","causes":["first","second: file does not exist","file does not exist"]}`,
+		`"x":1,"n":null`,
+	} {
+		if !strings.Contains(lines[i], expect) {
+			t.Errorf("line %d: expect %s, got %s", i, expect, lines[i])
+		}
+	}
+}
+
+func TestErrorStacktrace(t *testing.T) {
+	var path = filepath.Join(t.TempDir(), "stack.log")
+	var logger, err = NewSimpleLogger("info", path, "json", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ReplaceLogger(logger)()
+	SetErrorStacktrace(true)
+	defer SetErrorStacktrace(false)
+
+	var ctx = NamedContext("TestErrorStacktrace")
+	ctx.Warn("warn", errors.New("boom"))
+	ctx.Error("error", errors.New("boom"))
+	ctx.Error("no error value", "k", "v")
+	ctx.Logger().Error("logger", errors.New("boom"))
+	logger.Sync()
+
+	var b, _ = os.ReadFile(path)
+	var lines = strings.Split(strings.TrimSpace(string(b)), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("expect 4 lines, got %d: %s", len(lines), b)
+	}
+	if strings.Contains(lines[0], "stacktrace") || strings.Contains(lines[2], "stacktrace") {
+		t.Errorf("unexpected stacktrace: %s", b)
+	}
+	for _, i := range []int{1, 3} {
+		if !strings.Contains(lines[i], `"stacktrace":"github.com/cjey/xiao.TestErrorStacktrace`) {
+			t.Errorf("stacktrace should start from the caller: %s", lines[i])
+		}
+	}
+}
+
+func TestErrorFieldStack(t *testing.T) {
+	var path = filepath.Join(t.TempDir(), "gstack.log")
+	var logger, err = NewSimpleLogger("info", path, "json", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ReplaceLogger(logger)()
+	gerror.SetCaptureStack(true)
+	defer gerror.SetCaptureStack(false)
+
+	var ctx = NamedContext("TestErrorFieldStack")
+	ctx.Warn("gerror", gerror.New(typepb.Field_TYPE_STRING, "bad input"))
+	logger.Sync()
+
+	var b, _ = os.ReadFile(path)
+	if !strings.Contains(string(b), `"message":"bad input","stack":"github.com/cjey/xiao.TestErrorFieldStack\n\t`) {
+		t.Errorf("gerror stack should be logged: %s", b)
+	}
+}
+
+func TestErrorFieldTypedNil(t *testing.T) {
+	var path = filepath.Join(t.TempDir(), "nil.log")
+	var logger, err = NewSimpleLogger("info", path, "json", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ReplaceLogger(logger)()
+
+	var ctx = NamedContext("TestErrorFieldTypedNil")
+	var gerr *gerror.GError
+	ctx.Info("value", "err", error(gerr))
+	ctx.Info("bare", error(gerr))
+	ctx.Info("field", zap.Error(error(gerr)))
+	logger.Sync()
+
+	var b, _ = os.ReadFile(path)
+	var lines = strings.Split(strings.TrimSpace(string(b)), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expect 3 lines, got %d: %s", len(lines), b)
+	}
+	for i, line := range lines {
+		if !strings.Contains(line, `"err":"<nil>"`) && !strings.Contains(line, `"error":"<nil>"`) {
+			t.Errorf("line %d: typed nil should be logged as <nil>, got %s", i, line)
+		}
+	}
+	var enc = zapcore.NewMapObjectEncoder()
+	if err := (errorField{error(gerr)}).MarshalLogObject(enc); err != nil || enc.Fields["error"] != "<nil>" {
+		t.Errorf("typed nil should be marshaled as <nil>: %v %v", enc.Fields, err)
+	}
+}
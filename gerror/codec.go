@@ -1,11 +1,15 @@
 package gerror
 
 import (
+	"encoding/json"
 	"fmt"
 	"strings"
 
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/protoadapt"
 	"google.golang.org/protobuf/reflect/protoreflect"
 	"google.golang.org/protobuf/types/known/structpb"
 )
@@ -21,6 +25,7 @@ const (
 	_FIELD_NAME_CODE    = "code"
 	_FIELD_NAME_NAME    = "name"
 	_FIELD_NAME_MESSAGE = "message"
+	_FIELD_NAME_DETAILS = "details"
 )
 
 // Encode encodes the code and msg and send to client
@@ -35,11 +40,51 @@ func (e *GError) Encode() error {
 		prefix = fmt.Sprintf("%s # %s[%d]: %s", _MAGIC_PREFIX, e.Name, e.Code, e.Message)
 	}
 
-	details, _ := structpb.NewValue(map[string]any{
+	fields := map[string]any{
 		"code": e.Code, "name": e.Name, "message": e.Message,
-	})
-	sts, _ := status.New(codes.Unknown, prefix).WithDetails(details)
-	return sts.Err()
+	}
+	// keep the structpb as the only detail, which is required by older decoders,
+	// rich details are nested in it as json with @type
+	if raws, err := e.marshalJSON(); err == nil && len(raws) > 0 {
+		var list = make([]any, 0, len(raws))
+		for _, raw := range raws {
+			var v any
+			if json.Unmarshal(raw, &v) == nil {
+				list = append(list, v)
+			}
+		}
+		fields[_FIELD_NAME_DETAILS] = list
+	}
+	val, _ := structpb.NewValue(fields)
+	return withDetails(status.New(codes.Unknown, prefix), val).Err()
+}
+
+// Err 返回e对应的可以直接返回给grpc客户端的error，
+// OK返回nil，grpc错误返回对应code的普通status并附带详情，业务错误与Encode相同。
+// 与Encode不同，Encode对所有的错误码（包括OK和grpc错误）都会编码为带有magic前缀的Unknown status。
+func (e *GError) Err() error {
+	if e.OK() {
+		return nil
+	}
+	if e.IsGrpc() {
+		return withDetails(status.New(codes.Code(-1*e.Code), e.Message), e.messages()...).Err()
+	}
+	return e.Encode()
+}
+
+// withDetails attaches msgs to sts, sts is returned unchanged if failed
+func withDetails(sts *status.Status, msgs ...proto.Message) *status.Status {
+	if len(msgs) == 0 {
+		return sts
+	}
+	var pbs = make([]protoadapt.MessageV1, len(msgs))
+	for i, m := range msgs {
+		pbs[i] = protoadapt.MessageV1Of(m)
+	}
+	if s, err := sts.WithDetails(pbs...); err == nil {
+		return s
+	}
+	return sts
 }
 
 // Decode decodes error returned by server to *GError
@@ -51,7 +96,7 @@ func Decode(err error) *GError {
 		if e == nil {
 			return &GError{Code: 0, Name: "OK"}
 		}
-		return e
+		return fillName(e)
 	}
 
 	sts := status.Convert(err)
@@ -59,23 +104,34 @@ func Decode(err error) *GError {
 		// OK always without message
 		return &GError{Code: 0, Name: "OK"}
 	}
+	var ds details
+	var val *structpb.Value
+	for _, d := range sts.Details() {
+		if !ds.decode(d) {
+			if v, ok := d.(*structpb.Value); ok && val == nil {
+				val = v
+			}
+		}
+	}
 	// try to extract server predefined error info
 	if sts.Code() == codes.Unknown {
 		if strings.HasPrefix(sts.Message(), _MAGIC_PREFIX) {
 			// pattern hitted!
-			if ds := sts.Details(); len(ds) == 1 {
-				if val, ok := ds[0].(*structpb.Value); ok {
-					if st := val.GetStructValue(); st != nil && st.Fields != nil {
-						e := &GError{
-							Code:    int32(st.Fields["code"].GetNumberValue()),
-							Name:    st.Fields["name"].GetStringValue(),
-							Message: st.Fields["message"].GetStringValue(),
-						}
-						if e.Code > 0 {
-							return e
-						}
+			if st := val.GetStructValue(); st != nil && st.Fields != nil {
+				for _, v := range st.Fields[_FIELD_NAME_DETAILS].GetListValue().GetValues() {
+					if raw, err := protojson.Marshal(v); err == nil {
+						ds.decodeJSON(raw)
 					}
 				}
+				e := &GError{
+					Code:    int32(st.Fields["code"].GetNumberValue()),
+					Name:    st.Fields["name"].GetStringValue(),
+					Message: st.Fields["message"].GetStringValue(),
+					details: ds,
+				}
+				if e.Code > 0 {
+					return fillName(e)
+				}
 			}
 		}
 	}
@@ -84,5 +140,6 @@ func Decode(err error) *GError {
 		Code:    -1 * int32(sts.Code()),
 		Name:    sts.Code().String(),
 		Message: sts.Message(),
+		details: ds,
 	}
 }
@@ -1,8 +1,11 @@
 package gerror
 
 import (
+	"strings"
 	"testing"
 
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/types/known/typepb"
 )
 
@@ -25,3 +28,33 @@ func TestEncode2(t *testing.T) {
 		t.Errorf("bad codec")
 	}
 }
+
+func TestErrGrpc(t *testing.T) {
+	err := Grpc(GrpcInternal, "panic: %s", "boom").Err()
+	if status.Code(err) != GrpcInternal {
+		t.Errorf("grpc error should be a plain status, got %v", err)
+	}
+	gerr := Decode(err)
+	if !gerr.IsGrpc() || !gerr.Equal(GrpcInternal) || gerr.Message != "panic: boom" {
+		t.Errorf("bad codec: %v", gerr)
+	}
+	if (&GError{Name: "OK"}).Err() != nil {
+		t.Errorf("ok should be nil")
+	}
+	if err := New(typepb.Field_TYPE_STRING, "x").Err(); status.Code(err) != codes.Unknown {
+		t.Errorf("business error should be the same as Encode, got %v", err)
+	}
+}
+
+func TestEncodeCompat(t *testing.T) {
+	for _, e := range []*GError{
+		{Code: 0, Name: "OK"},
+		Grpc(GrpcInternal, "panic"),
+		New(typepb.Field_TYPE_STRING, "x"),
+	} {
+		sts := status.Convert(e.Encode())
+		if sts.Code() != codes.Unknown || !strings.HasPrefix(sts.Message(), _MAGIC_PREFIX) || len(sts.Details()) != 1 {
+			t.Errorf("%v should be encoded with magic prefix, got %v", e, sts.Proto())
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package gerror
+
+import (
+	"encoding/json"
+	"maps"
+	"slices"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// details 保存了GError可选的google.rpc标准详情。
+// 业务错误的详情以带有@type的json嵌套在code/name/message所在的structpb中，
+// 从而保持status中只有一项detail，旧版本的Decode仍然可以解码；grpc错误的详情直接附加在status中。
+type details struct {
+	badRequest   *errdetails.BadRequest
+	retryInfo    *errdetails.RetryInfo
+	errorInfo    *errdetails.ErrorInfo
+	resourceInfo *errdetails.ResourceInfo
+}
+
+// messages 返回需要编码的详情
+func (d *details) messages() []proto.Message {
+	var msgs []proto.Message
+	if d.badRequest != nil {
+		msgs = append(msgs, d.badRequest)
+	}
+	if d.retryInfo != nil {
+		msgs = append(msgs, d.retryInfo)
+	}
+	if d.errorInfo != nil {
+		msgs = append(msgs, d.errorInfo)
+	}
+	if d.resourceInfo != nil {
+		msgs = append(msgs, d.resourceInfo)
+	}
+	return msgs
+}
+
+// decode 识别并保存标准详情，不认识的类型返回false
+func (d *details) decode(detail any) bool {
+	switch v := detail.(type) {
+	case *errdetails.BadRequest:
+		d.badRequest = v
+	case *errdetails.RetryInfo:
+		d.retryInfo = v
+	case *errdetails.ErrorInfo:
+		d.errorInfo = v
+	case *errdetails.ResourceInfo:
+		d.resourceInfo = v
+	default:
+		return false
+	}
+	return true
+}
+
+// marshalJSON 将详情编码为带有@type的json，与grpc-gateway的格式相同
+func (d *details) marshalJSON() ([]json.RawMessage, error) {
+	var raws []json.RawMessage
+	for _, m := range d.messages() {
+		a, err := anypb.New(m)
+		if err != nil {
+			return nil, err
+		}
+		data, err := protojson.Marshal(a)
+		if err != nil {
+			return nil, err
+		}
+		raws = append(raws, data)
+	}
+	return raws, nil
+}
+
+// decodeJSON 解码一项marshalJSON编码的详情，无法解码或者不认识的详情会被忽略
+func (d *details) decodeJSON(raw []byte) {
+	var a anypb.Any
+	if err := protojson.Unmarshal(raw, &a); err != nil {
+		return
+	}
+	if m, err := a.UnmarshalNew(); err == nil {
+		d.decode(m)
+	}
+}
+
+// 以下的With方法都会返回添加了详情的副本，不会修改e本身，
+// 因此也可以在全局共享的*GError上调用，例如 ErrBreakerOpen.WithRetryDelay(time.Second)
+
+// WithFieldViolation 添加一个BadRequest的字段错误，通常用于参数校验失败
+func (e *GError) WithFieldViolation(field, description string) *GError {
+	var c = *e
+	var violations = append(slices.Clone(e.FieldViolations()),
+		&errdetails.BadRequest_FieldViolation{Field: field, Description: description})
+	c.badRequest = &errdetails.BadRequest{FieldViolations: violations}
+	return &c
+}
+
+// WithRetryDelay 设置RetryInfo，告知调用方至少等待delay之后再重试
+func (e *GError) WithRetryDelay(delay time.Duration) *GError {
+	var c = *e
+	c.retryInfo = &errdetails.RetryInfo{RetryDelay: durationpb.New(delay)}
+	return &c
+}
+
+// WithErrorInfo 设置ErrorInfo，reason是错误原因的常量标识，domain是产生错误的服务或系统
+func (e *GError) WithErrorInfo(reason, domain string, metadata map[string]string) *GError {
+	var c = *e
+	c.errorInfo = &errdetails.ErrorInfo{Reason: reason, Domain: domain, Metadata: maps.Clone(metadata)}
+	return &c
+}
+
+// WithResourceInfo 设置ResourceInfo，描述错误相关的资源
+func (e *GError) WithResourceInfo(resourceType, resourceName, owner, description string) *GError {
+	var c = *e
+	c.resourceInfo = &errdetails.ResourceInfo{
+		ResourceType: resourceType,
+		ResourceName: resourceName,
+		Owner:        owner,
+		Description:  description,
+	}
+	return &c
+}
+
+// FieldViolations 返回BadRequest中的所有字段错误
+func (e *GError) FieldViolations() []*errdetails.BadRequest_FieldViolation {
+	return e.badRequest.GetFieldViolations()
+}
+
+// RetryDelay 返回RetryInfo中的等待时间，没有RetryInfo时ok为false
+func (e *GError) RetryDelay() (delay time.Duration, ok bool) {
+	if e.retryInfo == nil {
+		return 0, false
+	}
+	return e.retryInfo.GetRetryDelay().AsDuration(), true
+}
+
+// ErrorInfo 返回ErrorInfo，没有时返回nil
+func (e *GError) ErrorInfo() *errdetails.ErrorInfo {
+	return e.errorInfo
+}
+
+// ResourceInfo 返回ResourceInfo，没有时返回nil
+func (e *GError) ResourceInfo() *errdetails.ResourceInfo {
+	return e.resourceInfo
+}
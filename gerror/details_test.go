@@ -0,0 +1,75 @@
+package gerror
+
+import (
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/typepb"
+)
+
+func TestDetails(t *testing.T) {
+	err := New(typepb.Field_TYPE_STRING, "bad request").
+		WithFieldViolation("name", "must not be empty").
+		WithFieldViolation("age", "must be positive").
+		WithRetryDelay(3*time.Second).
+		WithErrorInfo("INVALID_USER", "user.example.com", map[string]string{"uid": "42"}).
+		WithResourceInfo("user", "users/42", "admin", "the user").
+		Encode()
+	// older decoders require exactly one structpb detail
+	if ds := status.Convert(err).Details(); len(ds) != 1 {
+		t.Fatalf("expect 1 detail, got %d", len(ds))
+	} else if st := ds[0].(*structpb.Value).GetStructValue(); st.Fields["code"].GetNumberValue() != 9 ||
+		st.Fields["name"].GetStringValue() != "TYPE_STRING" {
+		t.Fatalf("structpb should stay compatible: %v", st)
+	}
+
+	gerr := Decode(err)
+	if !gerr.Equal(typepb.Field_TYPE_STRING) || gerr.Message != "bad request" {
+		t.Fatalf("bad codec: %v", gerr)
+	}
+	if fvs := gerr.FieldViolations(); len(fvs) != 2 || fvs[0].GetField() != "name" || fvs[1].GetDescription() != "must be positive" {
+		t.Errorf("bad field violations: %v", fvs)
+	}
+	if delay, ok := gerr.RetryDelay(); !ok || delay != 3*time.Second {
+		t.Errorf("bad retry delay: %v %v", delay, ok)
+	}
+	if info := gerr.ErrorInfo(); info.GetReason() != "INVALID_USER" || info.GetMetadata()["uid"] != "42" {
+		t.Errorf("bad error info: %v", info)
+	}
+	if info := gerr.ResourceInfo(); info.GetResourceName() != "users/42" || info.GetOwner() != "admin" {
+		t.Errorf("bad resource info: %v", info)
+	}
+}
+
+func TestDetailsGrpc(t *testing.T) {
+	err := Grpc(GrpcResourceExhausted, "slow down").WithRetryDelay(time.Second).Err()
+	if status.Code(err) != GrpcResourceExhausted {
+		t.Fatalf("grpc error should be encoded as plain status, got %v", err)
+	}
+	gerr := Decode(err)
+	if delay, ok := gerr.RetryDelay(); !gerr.Equal(GrpcResourceExhausted) || !ok || delay != time.Second {
+		t.Errorf("bad codec: %v %v", gerr, delay)
+	}
+
+	gerr = Decode(New(typepb.Field_TYPE_STRING, "plain").Encode())
+	if _, ok := gerr.RetryDelay(); ok || gerr.ErrorInfo() != nil || gerr.FieldViolations() != nil {
+		t.Errorf("plain error should have no details: %v", gerr)
+	}
+}
+
+func TestDetailsClone(t *testing.T) {
+	var shared = Grpc(GrpcUnavailable, "shared")
+	var a = shared.WithRetryDelay(time.Second).WithFieldViolation("a", "bad")
+	var b = a.WithFieldViolation("b", "bad")
+	if _, ok := shared.RetryDelay(); ok || shared.FieldViolations() != nil {
+		t.Errorf("builders should not modify the receiver: %v", shared)
+	}
+	if len(a.FieldViolations()) != 1 || len(b.FieldViolations()) != 2 {
+		t.Errorf("builders should copy details: %v %v", a.FieldViolations(), b.FieldViolations())
+	}
+	if delay, _ := b.RetryDelay(); delay != time.Second {
+		t.Errorf("details should be kept by copies: %v", delay)
+	}
+}
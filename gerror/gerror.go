@@ -40,6 +40,11 @@ type GError struct {
 	Code    int32
 	Name    string
 	Message string
+
+	// optional google.rpc details, see details.go
+	details
+	// where the error was created, see stack.go
+	stack *stack
 }
 
 func New(code protoreflect.Enum, format string, a ...any) *GError {
@@ -47,6 +52,7 @@ func New(code protoreflect.Enum, format string, a ...any) *GError {
 		Code:    int32(code.Number()),
 		Name:    code.(interface{ String() string }).String(),
 		Message: fmt.Sprintf(format, a...),
+		stack:   captureStack(1),
 	}
 	if gerr.Code <= 0 {
 		panic(fmt.Errorf("error code must be a positive enum number"))
@@ -56,6 +62,19 @@ func New(code protoreflect.Enum, format string, a ...any) *GError {
 	return gerr
 }
 
+// Grpc return a grpc error with the given code, it will be encoded as a plain grpc status
+func Grpc(code codes.Code, format string, a ...any) *GError {
+	if code == codes.OK {
+		panic(fmt.Errorf("grpc error code must not be OK"))
+	}
+	return &GError{
+		Code:    -1 * int32(code),
+		Name:    code.String(),
+		Message: fmt.Sprintf(format, a...),
+		stack:   captureStack(1),
+	}
+}
+
 // OK means ok
 func (e *GError) OK() bool {
 	return e.Code == 0
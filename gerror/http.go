@@ -0,0 +1,186 @@
+package gerror
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// 本地和全局业务错误默认的http状态码
+const (
+	HTTP_STATUS_LOCAL  = http.StatusBadRequest
+	HTTP_STATUS_GLOBAL = http.StatusBadRequest
+)
+
+// _MAX_HTTP_BODY 是DecodeHTTPResponse读取的body上限
+const _MAX_HTTP_BODY = 1 << 20
+
+// grpc code到http状态码的默认映射，与grpc-gateway一致
+var _GRPC_HTTP_STATUS = map[codes.Code]int{
+	codes.OK:                 http.StatusOK,
+	codes.Canceled:           499,
+	codes.Unknown:            http.StatusInternalServerError,
+	codes.InvalidArgument:    http.StatusBadRequest,
+	codes.DeadlineExceeded:   http.StatusGatewayTimeout,
+	codes.NotFound:           http.StatusNotFound,
+	codes.AlreadyExists:      http.StatusConflict,
+	codes.PermissionDenied:   http.StatusForbidden,
+	codes.ResourceExhausted:  http.StatusTooManyRequests,
+	codes.FailedPrecondition: http.StatusBadRequest,
+	codes.Aborted:            http.StatusConflict,
+	codes.OutOfRange:         http.StatusBadRequest,
+	codes.Unimplemented:      http.StatusNotImplemented,
+	codes.Internal:           http.StatusInternalServerError,
+	codes.Unavailable:        http.StatusServiceUnavailable,
+	codes.DataLoss:           http.StatusInternalServerError,
+	codes.Unauthenticated:    http.StatusUnauthorized,
+}
+
+var _httpOverrides sync.Map // map[int32]int
+
+// SetHTTPStatus 为指定的错误码设置http状态码，覆盖默认的映射，httpStatus <= 0 时取消覆盖。
+// code只支持grpc.codes.Code或者protoreflect.Enum，与Equal相同。
+func SetHTTPStatus(code any, httpStatus int) {
+	var c int32
+	switch v := code.(type) {
+	case codes.Code:
+		c = -1 * int32(v)
+	case protoreflect.Enum:
+		c = int32(v.Number())
+	default:
+		panic(fmt.Errorf("unsupported error code type %T", code))
+	}
+	if httpStatus <= 0 {
+		_httpOverrides.Delete(c)
+	} else {
+		_httpOverrides.Store(c, httpStatus)
+	}
+}
+
+// HTTPStatus 返回e对应的http状态码，优先使用SetHTTPStatus设置的值
+func (e *GError) HTTPStatus() int {
+	if v, ok := _httpOverrides.Load(e.Code); ok {
+		return v.(int)
+	}
+	switch {
+	case e.OK():
+		return http.StatusOK
+	case e.IsLocal():
+		return HTTP_STATUS_LOCAL
+	case e.IsGlobal():
+		return HTTP_STATUS_GLOBAL
+	}
+	if s, ok := _GRPC_HTTP_STATUS[codes.Code(-1*e.Code)]; ok {
+		return s
+	}
+	return http.StatusInternalServerError
+}
+
+// httpBody 是http错误响应的json格式，details中的每一项都是带有@type的google.rpc详情
+type httpBody struct {
+	Code    int32             `json:"code"`
+	Name    string            `json:"name"`
+	Message string            `json:"message"`
+	Details []json.RawMessage `json:"details,omitempty"`
+}
+
+func newHTTPBody(e *GError) (*httpBody, error) {
+	var raws, err = e.marshalJSON()
+	if err != nil {
+		return nil, err
+	}
+	return &httpBody{Code: e.Code, Name: e.Name, Message: e.Message, Details: raws}, nil
+}
+
+// gerror 将body还原为*GError，不认识的详情会被忽略
+func (b *httpBody) gerror() *GError {
+	var e = &GError{Code: b.Code, Name: b.Name, Message: b.Message}
+	for _, raw := range b.Details {
+		e.decodeJSON(raw)
+	}
+	return e
+}
+
+// WriteHTTP 将err解码为*GError，并以对应的http状态码和json格式写入w，
+// 带有RetryInfo时同时设置Retry-After头
+func WriteHTTP(w http.ResponseWriter, err error) {
+	var e = Decode(err)
+	var body, merr = newHTTPBody(e)
+	var data []byte
+	if merr == nil {
+		data, merr = json.Marshal(body)
+	}
+	if merr != nil {
+		http.Error(w, e.Error(), e.HTTPStatus())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if delay, ok := e.RetryDelay(); ok {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(delay.Seconds()))))
+	}
+	w.WriteHeader(e.HTTPStatus())
+	w.Write(data)
+}
+
+// DecodeHTTP 将http响应解码为*GError，用于客户端。
+// body是WriteHTTP写入的json时使用其中的错误，否则根据状态码映射为grpc错误，2xx视为OK。
+// 只有同时带有非0的code和非空的name时才会被视为WriteHTTP写入的json，
+// 避免将其他服务常见的{"code":404,"message":"..."}误认为业务错误。
+func DecodeHTTP(httpStatus int, body []byte) *GError {
+	if httpStatus >= 200 && httpStatus < 300 {
+		return &GError{Code: 0, Name: "OK"}
+	}
+	var b httpBody
+	if json.Unmarshal(body, &b) == nil && b.Code != 0 && b.Name != "" {
+		return b.gerror()
+	}
+	var code = httpCode(httpStatus)
+	var msg = string(body)
+	if msg == "" {
+		msg = http.StatusText(httpStatus)
+	}
+	return &GError{Code: -1 * int32(code), Name: code.String(), Message: msg}
+}
+
+// DecodeHTTPResponse 读取resp.Body并使用DecodeHTTP解码，不会关闭resp.Body
+func DecodeHTTPResponse(resp *http.Response) *GError {
+	var body, _ = io.ReadAll(io.LimitReader(resp.Body, _MAX_HTTP_BODY))
+	return DecodeHTTP(resp.StatusCode, body)
+}
+
+// httpCode 将没有json body的http状态码映射为grpc code
+func httpCode(httpStatus int) codes.Code {
+	switch httpStatus {
+	case http.StatusBadRequest:
+		return codes.InvalidArgument
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound:
+		return codes.NotFound
+	case http.StatusConflict:
+		return codes.Aborted
+	case http.StatusTooManyRequests:
+		return codes.ResourceExhausted
+	case 499:
+		return codes.Canceled
+	case http.StatusNotImplemented:
+		return codes.Unimplemented
+	case http.StatusServiceUnavailable:
+		return codes.Unavailable
+	case http.StatusGatewayTimeout:
+		return codes.DeadlineExceeded
+	}
+	if httpStatus >= 500 {
+		return codes.Internal
+	}
+	return codes.Unknown
+}
@@ -0,0 +1,105 @@
+package gerror
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/types/known/typepb"
+)
+
+func TestHTTPDefaultJSON(t *testing.T) {
+	// the default json shape of GError is not changed by the http mapping
+	var data, _ = json.Marshal(Grpc(GrpcNotFound, "none"))
+	if string(data) != `{"Code":-5,"Name":"NotFound","Message":"none"}` {
+		t.Errorf("unexpected json: %s", data)
+	}
+}
+
+func TestHTTPStatus(t *testing.T) {
+	if s := New(typepb.Field_TYPE_STRING, "").HTTPStatus(); s != http.StatusBadRequest {
+		t.Errorf("local error should be 400, got %d", s)
+	}
+	if s := Grpc(GrpcNotFound, "").HTTPStatus(); s != http.StatusNotFound {
+		t.Errorf("not found should be 404, got %d", s)
+	}
+	if s := Decode(errors.New("plain")).HTTPStatus(); s != http.StatusInternalServerError {
+		t.Errorf("unknown should be 500, got %d", s)
+	}
+
+	SetHTTPStatus(typepb.Field_TYPE_STRING, http.StatusUnprocessableEntity)
+	SetHTTPStatus(GrpcNotFound, http.StatusGone)
+	defer SetHTTPStatus(typepb.Field_TYPE_STRING, 0)
+	defer SetHTTPStatus(GrpcNotFound, 0)
+	if s := New(typepb.Field_TYPE_STRING, "").HTTPStatus(); s != http.StatusUnprocessableEntity {
+		t.Errorf("override failed, got %d", s)
+	}
+	if s := Grpc(GrpcNotFound, "").HTTPStatus(); s != http.StatusGone {
+		t.Errorf("override failed, got %d", s)
+	}
+	if s := New(typepb.Field_TYPE_INT32, "").HTTPStatus(); s != http.StatusBadRequest {
+		t.Errorf("override should not affect other codes, got %d", s)
+	}
+}
+
+func TestWriteHTTP(t *testing.T) {
+	var w = httptest.NewRecorder()
+	WriteHTTP(w, New(typepb.Field_TYPE_STRING, "invalid name").
+		WithFieldViolation("name", "too long").
+		WithRetryDelay(1500*time.Millisecond).Encode())
+	if w.Code != http.StatusBadRequest || w.Header().Get("Retry-After") != "2" {
+		t.Fatalf("bad response: %d %v", w.Code, w.Header())
+	}
+	var body = w.Body.String()
+	if !strings.Contains(body, `"code":9,"name":"TYPE_STRING","message":"invalid name"`) ||
+		!strings.Contains(body, `"@type":"type.googleapis.com/google.rpc.BadRequest"`) {
+		t.Errorf("bad body: %s", body)
+	}
+
+	var gerr = DecodeHTTP(w.Code, w.Body.Bytes())
+	if !gerr.Equal(typepb.Field_TYPE_STRING) || gerr.Message != "invalid name" {
+		t.Fatalf("bad decode: %v", gerr)
+	}
+	if fvs := gerr.FieldViolations(); len(fvs) != 1 || fvs[0].GetDescription() != "too long" {
+		t.Errorf("bad field violations: %v", fvs)
+	}
+	if delay, ok := gerr.RetryDelay(); !ok || delay != 1500*time.Millisecond {
+		t.Errorf("bad retry delay: %v", delay)
+	}
+}
+
+func TestDecodeHTTP(t *testing.T) {
+	if gerr := DecodeHTTP(http.StatusNoContent, nil); !gerr.OK() {
+		t.Errorf("2xx should be ok: %v", gerr)
+	}
+	if gerr := DecodeHTTP(http.StatusServiceUnavailable, []byte("upstream down")); !gerr.Equal(GrpcUnavailable) ||
+		gerr.Message != "upstream down" {
+		t.Errorf("bad decode: %v", gerr)
+	}
+	// json from other services is not a gerror
+	var other = []byte(`{"code":404,"message":"no such page"}`)
+	if gerr := DecodeHTTP(http.StatusNotFound, other); !gerr.Equal(GrpcNotFound) || gerr.Message != string(other) {
+		t.Errorf("bad decode: %v", gerr)
+	}
+	if gerr := DecodeHTTP(http.StatusTeapot, nil); !gerr.Equal(GrpcUnknown) || gerr.Message != "I'm a teapot" {
+		t.Errorf("bad decode: %v", gerr)
+	}
+
+	var srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		WriteHTTP(w, Grpc(GrpcPermissionDenied, "no access"))
+	}))
+	defer srv.Close()
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if gerr := DecodeHTTPResponse(resp); resp.StatusCode != http.StatusForbidden || !gerr.Equal(GrpcPermissionDenied) ||
+		gerr.Message != "no access" {
+		t.Errorf("bad decode: %d %v", resp.StatusCode, gerr)
+	}
+}
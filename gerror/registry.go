@@ -0,0 +1,157 @@
+package gerror
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// CodeInfo 描述了一个已注册的错误码
+type CodeInfo struct {
+	Code        int32  `json:"code"`
+	Name        string `json:"name"`
+	Scope       string `json:"scope"` // local or global
+	Service     string `json:"service"`
+	Enum        string `json:"enum"` // full name of the enum
+	Description string `json:"description,omitempty"`
+}
+
+type registry struct {
+	mu    sync.RWMutex
+	codes map[int32]*CodeInfo
+}
+
+var _registry = &registry{codes: make(map[int32]*CodeInfo)}
+
+// Register 注册一个服务的错误码枚举，一般在init中调用。
+// 值为0的枚举项会被忽略，其余必须为正数且不能等于CODE_GLOBAL_BOUNDARY。
+// 本地错误码(<10000)在同一个进程中不能重复，全局错误码(>10000)在所有服务之间不能重复，
+// 重复注册同一个枚举是允许的。发生冲突时返回错误，且不会注册任何错误码。
+// 错误码的描述来自于枚举项在proto中的注释(如果生成的代码中包含了源码信息)。
+func Register(service string, enum protoreflect.EnumDescriptor) error {
+	var infos []*CodeInfo
+	var values = enum.Values()
+	var seen = make(map[int32]bool, values.Len())
+	for i := 0; i < values.Len(); i++ {
+		var v = values.Get(i)
+		var code = int32(v.Number())
+		if code == CODE_OK || seen[code] {
+			// skip OK and aliases
+			continue
+		}
+		seen[code] = true
+		if code < 0 || code == CODE_GLOBAL_BOUNDARY {
+			return fmt.Errorf("gerror: invalid code %s[%d] in %s", v.Name(), code, enum.FullName())
+		}
+		var info = &CodeInfo{
+			Code:    code,
+			Name:    string(v.Name()),
+			Scope:   "local",
+			Service: service,
+			Enum:    string(enum.FullName()),
+		}
+		if code > CODE_GLOBAL_BOUNDARY {
+			info.Scope = "global"
+		}
+		if loc := v.ParentFile().SourceLocations().ByDescriptor(v); loc.LeadingComments != "" {
+			info.Description = strings.TrimSpace(loc.LeadingComments)
+		} else {
+			info.Description = strings.TrimSpace(loc.TrailingComments)
+		}
+		infos = append(infos, info)
+	}
+
+	_registry.mu.Lock()
+	defer _registry.mu.Unlock()
+	for _, info := range infos {
+		if prev, ok := _registry.codes[info.Code]; ok && prev.Enum != info.Enum {
+			return fmt.Errorf("gerror: %s code %d conflict, %s.%s of %s and %s.%s of %s",
+				info.Scope, info.Code, prev.Enum, prev.Name, prev.Service, info.Enum, info.Name, info.Service)
+		}
+	}
+	for _, info := range infos {
+		if prev, ok := _registry.codes[info.Code]; ok && prev.Description != "" && info.Description == "" {
+			info.Description = prev.Description
+		}
+		_registry.codes[info.Code] = info
+	}
+	return nil
+}
+
+// MustRegister 与Register相同，但冲突时panic
+func MustRegister(service string, enum protoreflect.EnumDescriptor) {
+	if err := Register(service, enum); err != nil {
+		panic(err)
+	}
+}
+
+// SetDescription 设置已注册错误码的描述，错误码未注册时返回false
+func SetDescription(code int32, description string) bool {
+	_registry.mu.Lock()
+	defer _registry.mu.Unlock()
+	var info, ok = _registry.codes[code]
+	if ok {
+		var clone = *info
+		clone.Description = description
+		_registry.codes[code] = &clone
+	}
+	return ok
+}
+
+// Lookup 查询已注册的错误码
+func Lookup(code int32) (CodeInfo, bool) {
+	_registry.mu.RLock()
+	defer _registry.mu.RUnlock()
+	if info, ok := _registry.codes[code]; ok {
+		return *info, true
+	}
+	return CodeInfo{}, false
+}
+
+// Catalog 返回所有已注册的错误码，按错误码排序
+func Catalog() []CodeInfo {
+	_registry.mu.RLock()
+	var infos = make([]CodeInfo, 0, len(_registry.codes))
+	for _, info := range _registry.codes {
+		infos = append(infos, *info)
+	}
+	_registry.mu.RUnlock()
+	slices.SortFunc(infos, func(a, b CodeInfo) int { return int(a.Code - b.Code) })
+	return infos
+}
+
+// CatalogJSON 将Catalog导出为json数组
+func CatalogJSON() ([]byte, error) {
+	return json.MarshalIndent(Catalog(), "", "  ")
+}
+
+// CatalogMarkdown 将Catalog导出为markdown表格，可以直接用于API文档
+func CatalogMarkdown() string {
+	var b strings.Builder
+	b.WriteString("| Code | Name | Scope | Service | Enum | Description |\n")
+	b.WriteString("| ---: | ---- | ----- | ------- | ---- | ----------- |\n")
+	var escape = strings.NewReplacer("|", `\|`, "\r\n", "<br>", "\n", "<br>")
+	for _, info := range Catalog() {
+		fmt.Fprintf(&b, "| %d | %s | %s | %s | %s | %s |\n", info.Code,
+			escape.Replace(info.Name), info.Scope, escape.Replace(info.Service),
+			escape.Replace(info.Enum), escape.Replace(info.Description))
+	}
+	return b.String()
+}
+
+// fillName 使用注册的名称补全缺失的Name，用于兼容只传递了code的旧客户端，e本身不会被修改。
+// 只补全全局错误码，本地错误码只在各自的服务内有意义，本地注册的名称未必对应远端服务的错误码
+func fillName(e *GError) *GError {
+	if e.Name == "" && e.IsGlobal() {
+		if info, ok := Lookup(e.Code); ok {
+			var clone = *e
+			clone.Name = info.Name
+			return &clone
+		}
+	}
+	return e
+}
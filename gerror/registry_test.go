@@ -0,0 +1,125 @@
+package gerror
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/typepb"
+)
+
+func resetRegistry() func() {
+	var old = _registry
+	_registry = &registry{codes: make(map[int32]*CodeInfo)}
+	return func() { _registry = old }
+}
+
+func TestRegister(t *testing.T) {
+	defer resetRegistry()()
+
+	if err := Register("field", typepb.Field_TYPE_STRING.Descriptor()); err != nil {
+		t.Fatalf("register failed: %v", err)
+	}
+	// registering the same enum again is allowed
+	if err := Register("field", typepb.Field_TYPE_STRING.Descriptor()); err != nil {
+		t.Fatalf("register again failed: %v", err)
+	}
+	// cardinality 1~3 conflicts with kind 1~3
+	if err := Register("cardinality", typepb.Field_CARDINALITY_OPTIONAL.Descriptor()); err == nil {
+		t.Fatalf("conflict should be detected")
+	} else if !strings.Contains(err.Error(), "local code 1 conflict") {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if _, ok := Lookup(int32(typepb.Field_CARDINALITY_REPEATED)); !ok {
+		t.Errorf("code of the first registered enum should remain")
+	} else if info, _ := Lookup(3); info.Name != "TYPE_INT64" {
+		t.Errorf("conflicting registration should not overwrite, got %+v", info)
+	}
+
+	var info, ok = Lookup(int32(typepb.Field_TYPE_STRING))
+	if !ok || info.Name != "TYPE_STRING" || info.Service != "field" || info.Scope != "local" ||
+		info.Enum != "google.protobuf.Field.Kind" {
+		t.Errorf("bad lookup: %+v", info)
+	}
+	if _, ok := Lookup(0); ok {
+		t.Errorf("code 0 should not be registered")
+	}
+	if !SetDescription(int32(typepb.Field_TYPE_STRING), "a string | text") {
+		t.Errorf("set description failed")
+	}
+	if SetDescription(999, "none") {
+		t.Errorf("set description of unknown code should fail")
+	}
+}
+
+func TestCatalog(t *testing.T) {
+	defer resetRegistry()()
+
+	MustRegister("field", typepb.Field_TYPE_STRING.Descriptor())
+	SetDescription(int32(typepb.Field_TYPE_STRING), "a string | text")
+
+	var catalog = Catalog()
+	if len(catalog) != 18 || catalog[0].Code != 1 || catalog[17].Code != 18 {
+		t.Fatalf("bad catalog: %+v", catalog)
+	}
+
+	var data, err = CatalogJSON()
+	if err != nil {
+		t.Fatalf("export json failed: %v", err)
+	}
+	var decoded []CodeInfo
+	if err := json.Unmarshal(data, &decoded); err != nil || len(decoded) != 18 {
+		t.Fatalf("bad json: %s", data)
+	}
+
+	var md = CatalogMarkdown()
+	if !strings.Contains(md, "| 9 | TYPE_STRING | local | field | google.protobuf.Field.Kind | a string \\| text |\n") {
+		t.Errorf("bad markdown:\n%s", md)
+	}
+}
+
+// globalEnum 构造一个包含全局错误码的枚举
+func globalEnum(t *testing.T) protoreflect.EnumDescriptor {
+	var fd, err = protodesc.NewFile(&descriptorpb.FileDescriptorProto{
+		Name:    proto.String("gerror_test/global.proto"),
+		Package: proto.String("gerror.test"),
+		EnumType: []*descriptorpb.EnumDescriptorProto{{
+			Name: proto.String("GlobalCode"),
+			Value: []*descriptorpb.EnumValueDescriptorProto{
+				{Name: proto.String("OK"), Number: proto.Int32(0)},
+				{Name: proto.String("QUOTA_EXCEEDED"), Number: proto.Int32(10001)},
+			},
+		}},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fd.Enums().Get(0)
+}
+
+func TestDecodeFillName(t *testing.T) {
+	defer resetRegistry()()
+	MustRegister("common", globalEnum(t))
+	MustRegister("field", typepb.Field_TYPE_STRING.Descriptor())
+
+	// an old client sends the code only
+	var detail, _ = structpb.NewValue(map[string]any{"code": 10001, "message": "old"})
+	var sts, _ = status.New(GrpcUnknown, _MAGIC_PREFIX+" # [10001]: old").WithDetails(detail)
+	var gerr = Decode(sts.Err())
+	if gerr.Code != 10001 || gerr.Name != "QUOTA_EXCEEDED" {
+		t.Errorf("name should be filled from registry: %+v", gerr)
+	}
+	if gerr = Decode(&GError{Code: 10001}); gerr.Name != "QUOTA_EXCEEDED" {
+		t.Errorf("name should be filled from registry: %+v", gerr)
+	}
+	// local codes of a remote service may mean something else
+	if gerr = Decode(&GError{Code: 9}); gerr.Name != "" {
+		t.Errorf("name of local code should not be filled: %+v", gerr)
+	}
+}
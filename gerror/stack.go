@@ -0,0 +1,68 @@
+package gerror
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+	"strings"
+	"sync/atomic"
+)
+
+// 捕获的调用栈的最大深度
+const _MAX_STACK_DEPTH = 32
+
+var _captureStack atomic.Bool
+
+// SetCaptureStack 设置New和Grpc是否捕获创建错误时的调用栈，默认关闭。
+// 调用栈只用于服务端诊断，Encode时永远不会发送给客户端。
+func SetCaptureStack(enabled bool) {
+	_captureStack.Store(enabled)
+}
+
+// stack 是创建错误时的调用栈，使用指针保存，使GError仍然是可比较的
+type stack struct {
+	pcs []uintptr
+}
+
+// captureStack 在开启时捕获调用栈，skip为0表示captureStack的调用方
+func captureStack(skip int) *stack {
+	if !_captureStack.Load() {
+		return nil
+	}
+	var pcs [_MAX_STACK_DEPTH]uintptr
+	var n = runtime.Callers(skip+2, pcs[:])
+	return &stack{pcs: pcs[:n:n]}
+}
+
+// Stack 返回创建错误时捕获的调用栈，格式与panic时输出的调用栈相同，没有捕获时返回空字符串
+func (e *GError) Stack() string {
+	if e.stack == nil || len(e.stack.pcs) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	var frames = runtime.CallersFrames(e.stack.pcs)
+	for {
+		var frame, more = frames.Next()
+		fmt.Fprintf(&b, "%s\n\t%s:%d\n", frame.Function, frame.File, frame.Line)
+		if !more {
+			break
+		}
+	}
+	return b.String()
+}
+
+// Format 实现fmt.Formatter，%+v会在错误信息之后输出调用栈
+func (e *GError) Format(s fmt.State, verb rune) {
+	switch verb {
+	case 'q':
+		fmt.Fprintf(s, "%q", e.Error())
+	case 'v':
+		io.WriteString(s, e.Error())
+		if stack := e.Stack(); s.Flag('+') && stack != "" {
+			io.WriteString(s, "\n")
+			io.WriteString(s, stack)
+		}
+	default:
+		io.WriteString(s, e.Error())
+	}
+}
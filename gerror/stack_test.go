@@ -0,0 +1,53 @@
+package gerror
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/typepb"
+)
+
+func TestStack(t *testing.T) {
+	if gerr := New(typepb.Field_TYPE_STRING, "off"); gerr.Stack() != "" {
+		t.Errorf("stack should not be captured by default")
+	}
+
+	SetCaptureStack(true)
+	defer SetCaptureStack(false)
+
+	var gerr = New(typepb.Field_TYPE_STRING, "on")
+	var stack = gerr.Stack()
+	if !strings.HasPrefix(stack, "github.com/cjey/xiao/gerror.TestStack\n\t") || !strings.Contains(stack, "stack_test.go:") {
+		t.Errorf("stack should start at the caller of New:\n%s", stack)
+	}
+	if !strings.Contains(Grpc(GrpcInternal, "on").Stack(), "gerror.TestStack") {
+		t.Errorf("grpc error should capture stack too")
+	}
+
+	if s := fmt.Sprintf("%v", gerr); s != "TYPE_STRING[9]: on" {
+		t.Errorf("bad %%v: %s", s)
+	}
+	if s := fmt.Sprintf("%s|%q", gerr, gerr); s != `TYPE_STRING[9]: on|"TYPE_STRING[9]: on"` {
+		t.Errorf("bad %%s or %%q: %s", s)
+	}
+	if s := fmt.Sprintf("%+v", gerr); s != "TYPE_STRING[9]: on\n"+stack {
+		t.Errorf("bad %%+v: %s", s)
+	}
+
+	// never sent to the client
+	var err = gerr.Encode()
+	if strings.Contains(fmt.Sprint(status.Convert(err).Proto()), "stack_test.go") {
+		t.Errorf("stack should not be encoded")
+	}
+	if Decode(err).Stack() != "" {
+		t.Errorf("decoded error should have no stack")
+	}
+	var w = httptest.NewRecorder()
+	WriteHTTP(w, gerr)
+	if strings.Contains(w.Body.String(), "stack_test.go") {
+		t.Errorf("stack should not be written: %s", w.Body)
+	}
+}
@@ -0,0 +1,269 @@
+package xiao
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cjey/xiao/netkit"
+	"go.uber.org/zap/zapcore"
+)
+
+// HealthCheck 检查一项依赖是否正常，ctx带有注册时指定的超时时间
+type HealthCheck func(ctx Context) error
+
+// TCPCheck 返回一个通过建立tcp连接来检查addr是否可达的HealthCheck
+func TCPCheck(addr string) HealthCheck {
+	return func(ctx Context) error {
+		var timeout = time.Second
+		if remaining, ok := Remaining(ctx); ok {
+			timeout = remaining
+		}
+		var _, err = netkit.TCPing(addr, timeout)
+		return err
+	}
+}
+
+// DefaultHealthCacheTTL 是检查结果默认的缓存时间
+const DefaultHealthCacheTTL = 2 * time.Second
+
+// HealthResult 是一项检查的结果
+type HealthResult struct {
+	Status    string        `json:"status"`
+	Error     string        `json:"error,omitempty"`
+	Duration  time.Duration `json:"duration"`
+	CheckedAt time.Time     `json:"checked_at"`
+}
+
+func (r HealthResult) ok() bool {
+	return r.Status == "ok"
+}
+
+type healthCheck struct {
+	name     string
+	timeout  time.Duration
+	fn       HealthCheck
+	liveness bool
+
+	// mu serializes concurrent runs, so that only one request runs the check
+	mu     sync.Mutex
+	result atomic.Pointer[HealthResult]
+}
+
+// Health 是一个http.Handler，提供以下接口，可以挂载在任意前缀之下：
+//
+//	/healthz 存活检查，只执行通过AddLivenessCheck注册的检查
+//	/readyz  就绪检查，执行所有检查，并且要求SetReady(false)没有生效
+//	/info    进程信息，包括BootID、启动时间、Go版本、构建信息、管理网IP和当前的日志等级
+//
+// 检查的结果会被缓存CacheTTL时间，所有检查通过时返回200，否则返回503。
+type Health struct {
+	// CacheTTL 为0时使用DefaultHealthCacheTTL
+	CacheTTL time.Duration
+
+	mu       sync.RWMutex
+	checks   []*healthCheck
+	notReady atomic.Bool
+}
+
+// NewHealth 返回一个没有任何检查项的Health，默认是就绪的
+func NewHealth() *Health {
+	return &Health{}
+}
+
+// AddCheck 注册一项就绪检查，同名的检查会被替换，timeout <= 0 时不设置超时
+func (h *Health) AddCheck(name string, timeout time.Duration, fn HealthCheck) {
+	h.add(&healthCheck{name: name, timeout: timeout, fn: fn})
+}
+
+// AddLivenessCheck 注册一项存活检查，它同时也是就绪检查
+func (h *Health) AddLivenessCheck(name string, timeout time.Duration, fn HealthCheck) {
+	h.add(&healthCheck{name: name, timeout: timeout, fn: fn, liveness: true})
+}
+
+func (h *Health) add(c *healthCheck) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for i := range h.checks {
+		if h.checks[i].name == c.name {
+			h.checks[i] = c
+			return
+		}
+	}
+	h.checks = append(h.checks, c)
+}
+
+// SetReady 手动设置是否就绪，比如在启动完成前或者开始退出时设置为false
+func (h *Health) SetReady(ready bool) {
+	h.notReady.Store(!ready)
+}
+
+func (h *Health) ttl() time.Duration {
+	if h.CacheTTL > 0 {
+		return h.CacheTTL
+	}
+	return DefaultHealthCacheTTL
+}
+
+func (c *healthCheck) run(ttl time.Duration) HealthResult {
+	if r := c.result.Load(); r != nil && time.Since(r.CheckedAt) < ttl {
+		return *r
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// checked by another request while waiting
+	if r := c.result.Load(); r != nil && time.Since(r.CheckedAt) < ttl {
+		return *r
+	}
+
+	var ctx = NamedContext("Health").At(c.name)
+	if c.timeout > 0 {
+		var cancel CancelFunc
+		ctx, cancel = ctx.WithTimeout(c.timeout)
+		defer cancel()
+	}
+	var begin = time.Now()
+	var err = c.safeCall(ctx)
+	var r = &HealthResult{Status: "ok", Duration: time.Since(begin), CheckedAt: time.Now()}
+	if err != nil {
+		r.Status, r.Error = "fail", err.Error()
+		ctx.Warn("health check failed", "err", err)
+	}
+	c.result.Store(r)
+	return *r
+}
+
+// safeCall 执行检查，检查超时或者panic时都视为失败
+func (c *healthCheck) safeCall(ctx Context) (err error) {
+	var done = make(chan error, 1)
+	go func() {
+		defer func() {
+			if p := recover(); p != nil {
+				done <- fmt.Errorf("panic: %v", p)
+			}
+		}()
+		done <- c.fn(ctx)
+	}()
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	return
+}
+
+type healthReport struct {
+	Status string                  `json:"status"`
+	Checks map[string]HealthResult `json:"checks"`
+}
+
+// Check 执行检查并返回结果，liveness为true时只执行存活检查
+func (h *Health) Check(liveness bool) (ok bool, results map[string]HealthResult) {
+	h.mu.RLock()
+	var checks = make([]*healthCheck, 0, len(h.checks))
+	for _, c := range h.checks {
+		if c.liveness || !liveness {
+			checks = append(checks, c)
+		}
+	}
+	h.mu.RUnlock()
+
+	var ttl = h.ttl()
+	var all = make([]HealthResult, len(checks))
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			all[i] = c.run(ttl)
+		}()
+	}
+	wg.Wait()
+
+	ok, results = true, make(map[string]HealthResult, len(checks))
+	for i, c := range checks {
+		results[c.name] = all[i]
+		ok = ok && all[i].ok()
+	}
+	return ok, results
+}
+
+func (h *Health) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var path = strings.TrimSuffix(r.URL.Path, "/")
+	switch {
+	case strings.HasSuffix(path, "/healthz"):
+		var ok, results = h.Check(true)
+		h.writeReport(w, ok, results)
+	case strings.HasSuffix(path, "/readyz"):
+		var ok, results = h.Check(false)
+		if h.notReady.Load() {
+			ok = false
+			results["ready"] = HealthResult{Status: "fail", Error: "not ready", CheckedAt: time.Now()}
+		}
+		h.writeReport(w, ok, results)
+	case strings.HasSuffix(path, "/info"):
+		writeJSON(w, http.StatusOK, processInfo())
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (h *Health) writeReport(w http.ResponseWriter, ok bool, results map[string]HealthResult) {
+	var report = healthReport{Status: "ok", Checks: results}
+	var code = http.StatusOK
+	if !ok {
+		report.Status, code = "fail", http.StatusServiceUnavailable
+	}
+	writeJSON(w, code, report)
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	var enc = json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+// ProcessInfo 是/info接口返回的进程信息
+type ProcessInfo struct {
+	BootID    string            `json:"boot_id"`
+	BootTime  time.Time         `json:"boot_time"`
+	Uptime    string            `json:"uptime"`
+	GoVersion string            `json:"go_version"`
+	Path      string            `json:"path,omitempty"`
+	Module    string            `json:"module,omitempty"`
+	Version   string            `json:"version,omitempty"`
+	Settings  map[string]string `json:"settings,omitempty"`
+	ManIP     string            `json:"man_ip"`
+	LogLevel  string            `json:"log_level"`
+}
+
+func processInfo() *ProcessInfo {
+	var info = &ProcessInfo{
+		BootID:    BootID,
+		BootTime:  BootTime,
+		Uptime:    time.Since(BootTime).Round(time.Second).String(),
+		GoVersion: runtime.Version(),
+		ManIP:     netkit.MyManIP().String(),
+		LogLevel:  zapcore.LevelOf(_L.Core()).String(),
+	}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		info.Path, info.Module, info.Version = bi.Path, bi.Main.Path, bi.Main.Version
+		for _, s := range bi.Settings {
+			if strings.HasPrefix(s.Key, "vcs.") || s.Key == "GOOS" || s.Key == "GOARCH" {
+				if info.Settings == nil {
+					info.Settings = make(map[string]string)
+				}
+				info.Settings[s.Key] = s.Value
+			}
+		}
+	}
+	return info
+}
@@ -0,0 +1,96 @@
+package xiao
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHealth(t *testing.T) {
+	var ln, err = net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	var calls atomic.Int32
+	var failing atomic.Bool
+	var h = NewHealth()
+	h.CacheTTL = time.Hour
+	h.AddLivenessCheck("self", time.Second, func(ctx Context) error {
+		calls.Add(1)
+		if failing.Load() {
+			return errors.New("broken")
+		}
+		return nil
+	})
+	h.AddCheck("db", time.Second, TCPCheck(ln.Addr().String()))
+	h.AddCheck("slow", 10*time.Millisecond, func(ctx Context) error {
+		time.Sleep(time.Second)
+		return nil
+	})
+
+	var get = func(path string, v any) int {
+		var rec = httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+		if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+			t.Fatalf("bad json from %s: %s", path, rec.Body)
+		}
+		return rec.Code
+	}
+
+	var report healthReport
+	if code := get("/debug/healthz", &report); code != 200 || report.Status != "ok" || len(report.Checks) != 1 {
+		t.Errorf("unexpected healthz: %d %+v", code, report)
+	}
+	report = healthReport{}
+	if code := get("/readyz", &report); code != 503 || report.Checks["db"].Status != "ok" ||
+		report.Checks["slow"].Error != "context deadline exceeded" {
+		t.Errorf("unexpected readyz: %d %+v", code, report)
+	}
+
+	// cached
+	failing.Store(true)
+	get("/healthz", &report)
+	if calls.Load() != 1 || report.Status != "ok" {
+		t.Errorf("result should be cached, calls: %d", calls.Load())
+	}
+	h.CacheTTL = time.Nanosecond
+	report = healthReport{}
+	if code := get("/healthz", &report); code != 503 || report.Checks["self"].Error != "broken" {
+		t.Errorf("unexpected healthz: %d %+v", code, report)
+	}
+
+	h = NewHealth()
+	h.SetReady(false)
+	report = healthReport{}
+	if code := get("/readyz", &report); code != 503 || report.Checks["ready"].Error != "not ready" {
+		t.Errorf("unexpected readyz: %d %+v", code, report)
+	}
+
+	var info ProcessInfo
+	if code := get("/info", &info); code != 200 || info.BootID != BootID || info.GoVersion == "" || info.LogLevel == "" || info.ManIP == "" {
+		t.Errorf("unexpected info: %d %+v", code, info)
+	}
+
+	var rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/other", nil))
+	if rec.Code != 404 {
+		t.Errorf("unexpected code: %d", rec.Code)
+	}
+}
+
+func TestTCPCheck(t *testing.T) {
+	var ln, _ = net.Listen("tcp", "127.0.0.1:0")
+	var addr = ln.Addr().String()
+	ln.Close()
+	var ctx, cancel = NamedContext("TestTCPCheck").WithTimeout(time.Second)
+	defer cancel()
+	if err := TCPCheck(addr)(ctx); err == nil {
+		t.Errorf("closed port should fail")
+	}
+}
@@ -0,0 +1,220 @@
+package xiao
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// HookEntry 是传递给Hook的日志信息
+type HookEntry struct {
+	Level    zapcore.Level
+	Time     time.Time
+	Name     string
+	Location string
+	Message  string
+	Caller   zapcore.EntryCaller
+	// Fields 包括With添加的字段和本条日志的字段，但不包括'@'位置字段
+	Fields []zapcore.Field
+}
+
+// Hook 定义了一个日志回调，所有Context输出的日志，只要满足过滤条件，都会触发回调。
+// 回调在日志写出之后同步执行，因此对于Fatal等级，回调会在os.Exit之前执行。
+type Hook struct {
+	// MinLevel 只有不低于此等级的日志才会触发回调
+	MinLevel zapcore.Level
+	// NamePrefix 只有名称具有此前缀的日志才会触发回调，空字符串表示不过滤
+	NamePrefix string
+	// Func 回调函数
+	Func func(*HookEntry)
+}
+
+func (h *Hook) match(ent zapcore.Entry) bool {
+	return ent.Level >= h.MinLevel && strings.HasPrefix(ent.LoggerName, h.NamePrefix)
+}
+
+// 注册的回调列表，使用copy on write，保证日志输出时无锁读取
+var _hooks struct {
+	mu   sync.Mutex
+	list atomic.Pointer[[]*Hook]
+}
+
+// AddHook 注册一个日志回调，返回的函数用于取消注册
+func AddHook(h Hook) (remove func()) {
+	var hook = &h
+	_hooks.mu.Lock()
+	defer _hooks.mu.Unlock()
+	var list []*Hook
+	if prev := _hooks.list.Load(); prev != nil {
+		list = append(list, *prev...)
+	}
+	list = append(list, hook)
+	_hooks.list.Store(&list)
+
+	return func() {
+		_hooks.mu.Lock()
+		defer _hooks.mu.Unlock()
+		var prev = _hooks.list.Load()
+		if prev == nil {
+			return
+		}
+		var list = make([]*Hook, 0, len(*prev))
+		for _, h := range *prev {
+			if h != hook {
+				list = append(list, h)
+			}
+		}
+		_hooks.list.Store(&list)
+	}
+}
+
+func matchedHooks(ent zapcore.Entry) bool {
+	var list = _hooks.list.Load()
+	if list == nil {
+		return false
+	}
+	for _, h := range *list {
+		if h.match(ent) {
+			return true
+		}
+	}
+	return false
+}
+
+// LevelCounter 按日志等级进行计数
+type LevelCounter struct {
+	counts [zapcore.FatalLevel - zapcore.DebugLevel + 1]atomic.Uint64
+}
+
+// NewLevelCounter 返回一个LevelCounter，需要通过AddHook(counter.Hook())注册后才会开始计数
+func NewLevelCounter() *LevelCounter {
+	return &LevelCounter{}
+}
+
+// Hook 返回用于计数的回调，统计所有等级
+func (c *LevelCounter) Hook() Hook {
+	return Hook{
+		MinLevel: zapcore.DebugLevel,
+		Func: func(e *HookEntry) {
+			if e.Level >= zapcore.DebugLevel && e.Level <= zapcore.FatalLevel {
+				c.counts[e.Level-zapcore.DebugLevel].Add(1)
+			}
+		},
+	}
+}
+
+// Count 返回指定等级的日志条数
+func (c *LevelCounter) Count(lvl zapcore.Level) uint64 {
+	if lvl < zapcore.DebugLevel || lvl > zapcore.FatalLevel {
+		return 0
+	}
+	return c.counts[lvl-zapcore.DebugLevel].Load()
+}
+
+// OnFatal 注册一个在首次输出Fatal日志时执行的函数，它会在os.Exit之前被调用，
+// 一般用于flush缓存、上报等收尾工作。返回的函数用于取消注册。
+func OnFatal(fn func()) (remove func()) {
+	var once sync.Once
+	return AddHook(Hook{
+		MinLevel: zapcore.FatalLevel,
+		Func: func(*HookEntry) {
+			once.Do(fn)
+		},
+	})
+}
+
+// hookCore 会被ReplaceLogger自动安装到全局logger上，用于触发已注册的回调
+type hookCore struct {
+	zapcore.Core
+	fields []zapcore.Field
+}
+
+func newHookCore(core zapcore.Core) zapcore.Core {
+	return &hookCore{Core: core}
+}
+
+func (c *hookCore) With(fields []zapcore.Field) zapcore.Core {
+	var c2 = &hookCore{
+		Core:   c.Core.With(fields),
+		fields: make([]zapcore.Field, 0, len(c.fields)+len(fields)),
+	}
+	c2.fields = append(c2.fields, c.fields...)
+	c2.fields = append(c2.fields, fields...)
+	return c2
+}
+
+func (c *hookCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	ce = c.Core.Check(ent, ce)
+	if ce != nil && matchedHooks(ent) {
+		ce = ce.AddCore(ent, hookRunner{c})
+	}
+	return ce
+}
+
+func (c *hookCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	var err = c.Core.Write(ent, fields)
+	if matchedHooks(ent) {
+		c.run(ent, fields)
+	}
+	return err
+}
+
+func (c *hookCore) run(ent zapcore.Entry, fields []zapcore.Field) {
+	var list = _hooks.list.Load()
+	if list == nil {
+		return
+	}
+
+	var e = &HookEntry{
+		Level:   ent.Level,
+		Time:    ent.Time,
+		Name:    ent.LoggerName,
+		Message: ent.Message,
+		Caller:  ent.Caller,
+		Fields:  make([]zapcore.Field, 0, len(c.fields)+len(fields)),
+	}
+	for _, fs := range [][]zapcore.Field{c.fields, fields} {
+		for _, f := range fs {
+			if f.Key == locationKey && f.Type == zapcore.StringType {
+				e.Location = f.String
+			} else {
+				e.Fields = append(e.Fields, f)
+			}
+		}
+	}
+
+	for _, h := range *list {
+		if h.match(ent) {
+			h.Func(e)
+		}
+	}
+}
+
+// hookRunner 只执行回调，不写出日志，用于在Check时追加到CheckedEntry的末尾
+type hookRunner struct {
+	c *hookCore
+}
+
+func (r hookRunner) Enabled(zapcore.Level) bool {
+	return true
+}
+
+func (r hookRunner) With([]zapcore.Field) zapcore.Core {
+	return r
+}
+
+func (r hookRunner) Check(_ zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	return ce
+}
+
+func (r hookRunner) Sync() error {
+	return nil
+}
+
+func (r hookRunner) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	r.c.run(ent, fields)
+	return nil
+}
@@ -0,0 +1,60 @@
+package xiao
+
+import (
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestHook(t *testing.T) {
+	var core, logs = observer.New(zapcore.InfoLevel)
+	defer ReplaceLogger(zap.New(core, zap.WithFatalHook(zapcore.WriteThenPanic)))()
+
+	var counter = NewLevelCounter()
+	defer AddHook(counter.Hook())()
+
+	var entries []*HookEntry
+	defer AddHook(Hook{
+		MinLevel:   zapcore.ErrorLevel,
+		NamePrefix: "TestHook",
+		Func:       func(e *HookEntry) { entries = append(entries, e) },
+	})()
+
+	var fatals int
+	defer OnFatal(func() {
+		fatals++
+		if logs.Len() != 4 {
+			t.Errorf("fatal hook should run after the entry written")
+		}
+	})()
+
+	var ctx = NamedContext("TestHook").At("check")
+	ctx.Debug("not enabled")
+	ctx.Info("info")
+	ctx.Logger().With("k", "v").Error("failed", "code", 1)
+	NamedContext("Other").Error("other")
+
+	if len(entries) != 1 {
+		t.Fatalf("expect 1 hooked entry, got %d", len(entries))
+	}
+	var e = entries[0]
+	if e.Name != "TestHook" || e.Location != "check" || e.Message != "failed" || len(e.Fields) != 2 {
+		t.Errorf("unexpected hook entry: %+v", e)
+	}
+	if counter.Count(zapcore.DebugLevel) != 0 || counter.Count(zapcore.InfoLevel) != 1 ||
+		counter.Count(zapcore.ErrorLevel) != 2 {
+		t.Errorf("unexpected level counter")
+	}
+
+	for i := 0; i < 2; i++ {
+		func() {
+			defer func() { recover() }()
+			ctx.Fatal("fatal")
+		}()
+	}
+	if fatals != 1 {
+		t.Errorf("fatal hook should run only once, got %d", fatals)
+	}
+}
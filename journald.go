@@ -0,0 +1,130 @@
+package xiao
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"strconv"
+	"strings"
+)
+
+const _JOURNALD_SOCKET = "/run/systemd/journal/socket"
+
+// journaldWriter 使用journald原生协议输出日志，
+// 名称、位置、session和调用位置分别对应XIAO_NAME、XIAO_LOCATION、XIAO_SESSION和CODE_*字段，
+// 其余字段的名称会被转换为大写，非法字符替换为下划线，
+// 与journald或者本身使用的字段同名，以及以下划线开头的字段会被加上XIAO_前缀，参见journaldReserved。
+// 注意：单条日志不能超过socket的数据报大小限制。
+type journaldWriter struct {
+	app  string
+	conn *net.UnixConn
+	addr *net.UnixAddr
+}
+
+func newJournaldWriter(path, app string) (*journaldWriter, error) {
+	if path == "" {
+		path = _JOURNALD_SOCKET
+	}
+	var conn, err = net.ListenUnixgram("unixgram", &net.UnixAddr{Net: "unixgram"})
+	if err != nil {
+		return nil, err
+	}
+	return &journaldWriter{
+		app:  app,
+		conn: conn,
+		addr: &net.UnixAddr{Name: path, Net: "unixgram"},
+	}, nil
+}
+
+// journaldReserved 判断字段名是否与journald或者journaldWriter本身写入的字段冲突
+func journaldReserved(name string) bool {
+	switch name {
+	case "MESSAGE", "MESSAGE_ID", "PRIORITY":
+		return true
+	}
+	for _, prefix := range []string{"_", "SYSLOG_", "CODE_", "XIAO_"} {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// journaldFieldName 将用户给定的字段名转换为合法且不与保留字段冲突的journal字段名
+func journaldFieldName(s string) string {
+	var b = make([]byte, 0, min(len(s), 64))
+	for i := 0; i < len(s) && len(b) < 64; i++ {
+		switch c := s[i]; {
+		case c >= 'a' && c <= 'z':
+			b = append(b, c-'a'+'A')
+		case c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+			b = append(b, c)
+		default:
+			b = append(b, '_')
+		}
+	}
+	switch {
+	case journaldReserved(string(b)):
+		b = append([]byte("XIAO_"), b...)
+	case len(b) == 0 || b[0] < 'A' || b[0] > 'Z':
+		// must start with a letter
+		b = append([]byte("F"), b...)
+	}
+	if len(b) > 64 {
+		b = b[:64]
+	}
+	return string(b)
+}
+
+func appendJournaldField(buf *bytes.Buffer, name, value string) {
+	buf.WriteString(name)
+	if strings.IndexByte(value, '\n') < 0 {
+		buf.WriteByte('=')
+		buf.WriteString(value)
+		buf.WriteByte('\n')
+		return
+	}
+	// binary safe format
+	buf.WriteByte('\n')
+	binary.Write(buf, binary.LittleEndian, uint64(len(value)))
+	buf.WriteString(value)
+	buf.WriteByte('\n')
+}
+
+func (w *journaldWriter) format(r *logRecord) []byte {
+	var buf bytes.Buffer
+	appendJournaldField(&buf, "MESSAGE", r.Message)
+	appendJournaldField(&buf, "PRIORITY", strconv.Itoa(syslogSeverity(r.Level)))
+	appendJournaldField(&buf, "SYSLOG_IDENTIFIER", w.app)
+	if r.LoggerName != "" {
+		appendJournaldField(&buf, "XIAO_NAME", r.LoggerName)
+		appendJournaldField(&buf, "XIAO_SESSION", r.Session())
+	}
+	if r.Location != "" {
+		appendJournaldField(&buf, "XIAO_LOCATION", r.Location)
+	}
+	if r.Caller.Defined {
+		appendJournaldField(&buf, "CODE_FILE", r.Caller.File)
+		appendJournaldField(&buf, "CODE_LINE", strconv.Itoa(r.Caller.Line))
+		if r.Caller.Function != "" {
+			appendJournaldField(&buf, "CODE_FUNC", r.Caller.Function)
+		}
+	}
+	for _, k := range r.Keys {
+		appendJournaldField(&buf, journaldFieldName(k), r.FieldString(k))
+	}
+	return buf.Bytes()
+}
+
+func (w *journaldWriter) WriteRecord(r *logRecord) error {
+	var _, err = w.conn.WriteToUnix(w.format(r), w.addr)
+	return err
+}
+
+func (w *journaldWriter) Sync() error {
+	return nil
+}
+
+func (w *journaldWriter) Close() error {
+	return w.conn.Close()
+}
@@ -0,0 +1,80 @@
+package xiao
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// Lazy 用于延迟计算日志的值，只有日志确实会被输出时才会被调用，
+// 适用于构建代价较高的debug数据，例如json dump、报文的hex等。
+// 在kvs中直接使用func() any也会被自动视为Lazy。
+//
+//	ctx.Debug("packet received", "hex", xiao.Lazy(func() any { return hex.Dump(pkt) }))
+type Lazy func() any
+
+// MarshalJSON 在编码时才会调用函数取值
+func (f Lazy) MarshalJSON() ([]byte, error) {
+	return json.Marshal(f())
+}
+
+// Format 使Lazy也可以用于Debugf等格式化参数
+func (f Lazy) Format(s fmt.State, verb rune) {
+	fmt.Fprintf(s, fmt.FormatString(s, verb), f())
+}
+
+// lazyValue 缓存Lazy的结果，同一条日志被多个输出目标编码时只会计算一次
+type lazyValue struct {
+	once sync.Once
+	f    Lazy
+	v    any
+}
+
+func (l *lazyValue) value() any {
+	l.once.Do(func() {
+		l.v = l.f()
+	})
+	return l.v
+}
+
+func (l *lazyValue) MarshalJSON() ([]byte, error) {
+	return json.Marshal(l.value())
+}
+
+func (l *lazyValue) Format(s fmt.State, verb rune) {
+	fmt.Fprintf(s, fmt.FormatString(s, verb), l.value())
+}
+
+// lazyKVs 将kvs中的func() any和Lazy转换为只计算一次的lazyValue，只在有改动时才会复制
+func lazyKVs(kvs []any) []any {
+	var out []any
+	for i := 0; i < len(kvs); i++ {
+		if _, ok := kvs[i].(zapcore.Field); ok {
+			continue
+		}
+		// key, value pair
+		if i++; i >= len(kvs) {
+			break
+		}
+		var f Lazy
+		switch v := kvs[i].(type) {
+		case func() any:
+			f = v
+		case Lazy:
+			f = v
+		default:
+			continue
+		}
+		if out == nil {
+			out = make([]any, len(kvs))
+			copy(out, kvs)
+		}
+		out[i] = &lazyValue{f: f}
+	}
+	if out == nil {
+		return kvs
+	}
+	return out
+}
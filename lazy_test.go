@@ -0,0 +1,84 @@
+package xiao
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestLazy(t *testing.T) {
+	var path = filepath.Join(t.TempDir(), "lazy.log")
+	var logger, err = NewSimpleLogger("info", path, "json", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ReplaceLogger(logger)()
+
+	var calls int
+	var dump = func() any {
+		calls++
+		return map[string]int{"size": 42}
+	}
+
+	var ctx = NamedContext("TestLazy")
+	if ctx.DebugEnabled() || !ctx.Logger().Enabled(InfoLevel) {
+		t.Errorf("unexpected enabled levels")
+	}
+	ctx.Debug("dropped", "dump", dump)
+	ctx.Debugf("dropped %v", Lazy(dump))
+	if calls != 0 {
+		t.Fatalf("lazy value should not be evaluated for dropped entries")
+	}
+
+	ctx.Info("written", zap.String("k", "v"), "dump", dump)
+	ctx.Infof("written %v", Lazy(dump))
+	logger.Sync()
+	if calls != 2 {
+		t.Errorf("expect 2 evaluations, got %d", calls)
+	}
+	var b, _ = os.ReadFile(path)
+	if s := string(b); !strings.Contains(s, `"dump":{"size":42}`) || !strings.Contains(s, `written map[size:42]`) {
+		t.Errorf("unexpected output: %s", s)
+	}
+
+	if !ctx.WithLevel(DebugLevel).DebugEnabled() {
+		t.Errorf("debug should be enabled by WithLevel")
+	}
+	ctx.Mute()
+	if ctx.Logger().Enabled(ErrorLevel) {
+		t.Errorf("muted logger should not be enabled")
+	}
+}
+
+func TestLazyMultiSink(t *testing.T) {
+	var dir = t.TempDir()
+	var logger, err = NewSinkLogger([]SinkConfig{
+		{Level: "info", Path: filepath.Join(dir, "a.log"), Encoding: "json"},
+		{Level: "info", Path: filepath.Join(dir, "b.log"), Encoding: "console"},
+	}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ReplaceLogger(logger)()
+
+	var calls int
+	var dump = func() any {
+		calls++
+		return calls
+	}
+	var ctx = NamedContext("TestLazyMultiSink")
+	ctx.Info("written", "dump", dump, "lazy", Lazy(dump))
+	logger.Sync()
+	if calls != 2 {
+		t.Errorf("each lazy value should be evaluated once for all sinks, got %d", calls)
+	}
+	for _, name := range []string{"a.log", "b.log"} {
+		var b, _ = os.ReadFile(filepath.Join(dir, name))
+		if s := string(b); !strings.Contains(s, `"dump":1`) && !strings.Contains(s, `"dump": 1`) {
+			t.Errorf("sinks should share the same value: %s", s)
+		}
+	}
+}
@@ -2,6 +2,19 @@ package xiao
 
 import (
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Level is the log level, alias of zapcore.Level
+type Level = zapcore.Level
+
+const (
+	DebugLevel = zapcore.DebugLevel
+	InfoLevel  = zapcore.InfoLevel
+	WarnLevel  = zapcore.WarnLevel
+	ErrorLevel = zapcore.ErrorLevel
+	PanicLevel = zapcore.PanicLevel
+	FatalLevel = zapcore.FatalLevel
 )
 
 // NameJoiner will generate a full name after joining the origin and given.
@@ -44,8 +57,15 @@ type Logger interface {
 	Fatal(msg string, kvs ...any)
 	Fatalf(template string, args ...any)
 
+	// Enabled return true if the given level will be written,
+	// use it to avoid building expensive data for dropped entries
+	Enabled(level Level) bool
+
 	// With return a Logger with specified key/value pairs
 	With(kvs ...any) Logger
+	// WithLevel return a Logger with the given minimum level,
+	// independent of the level of the underlying zap logger
+	WithLevel(level Level) Logger
 	// Sync flush log buffers
 	Sync() error
 
@@ -59,6 +79,10 @@ type logger struct {
 	zap0  *zap.SugaredLogger
 	zap   *zap.SugaredLogger
 	muted bool
+	// skip is the accumulated caller skip of zap, used by stacktrace
+	skip int
+	// core is the core of zap, used to skip prepare for disabled levels
+	core zapcore.Core
 
 	nameJoiner     NameJoiner
 	locationJoiner LocationJoiner
@@ -70,6 +94,9 @@ type logger struct {
 
 var _ Logger = &logger{}
 
+// locationKey is the field name of location used by default locationJoiner
+const locationKey = "@"
+
 // mostly return origin + . + given
 func nameJoineroiner(origin, given string) string {
 	const sep = "."
@@ -85,14 +112,13 @@ func nameJoineroiner(origin, given string) string {
 // mostly return @, origin + / + given
 func locationJoiner(origin, given string) (string, string) {
 	const sep = "/"
-	const key = "@"
 	if given != "" {
 		if origin != "" {
-			return key, origin + "/" + given
+			return locationKey, origin + "/" + given
 		}
-		return key, given
+		return locationKey, given
 	}
-	return key, origin
+	return locationKey, origin
 }
 
 // NewLogger return a Logger, with name and location.
@@ -113,6 +139,7 @@ func (l *logger) fork(skip int, name, location string) *logger {
 		zap0:  l.zap0,
 		zap:   l.zap0,
 		muted: l.muted,
+		skip:  l.skip + skip,
 
 		nameJoiner:     l.nameJoiner,
 		locationJoiner: l.locationJoiner,
@@ -153,6 +180,7 @@ func (l *logger) fork(skip int, name, location string) *logger {
 		if len(l2.with) > 0 {
 			l2.zap = l2.zap.With(l2.with...)
 		}
+		l2.core = l2.zap.Desugar().Core()
 	}
 
 	return l2
@@ -170,99 +198,133 @@ func (l *logger) Location() string {
 	return l.location
 }
 
-func (l *logger) Debug(msg string, kvs ...any) {
+func (l *logger) Enabled(level Level) bool {
 	if l.zap == nil || l.muted {
+		return false
+	}
+	return l.core.Enabled(level)
+}
+
+func (l *logger) Debug(msg string, kvs ...any) {
+	if l.zap == nil || l.muted || !l.core.Enabled(DebugLevel) {
 		return
 	}
-	l.zap.Debugw(msg, kvs...)
+	l.zap.Debugw(msg, l.prepare(DebugLevel, kvs)...)
 }
 
 func (l *logger) Debugf(template string, args ...any) {
-	if l.zap == nil || l.muted {
+	if l.zap == nil || l.muted || !l.core.Enabled(DebugLevel) {
 		return
 	}
-	l.zap.Debugf(template, args...)
+	l.zap.Debugf(template, l.prepareArgs(args)...)
 }
 
 func (l *logger) Info(msg string, kvs ...any) {
-	if l.zap == nil || l.muted {
+	if l.zap == nil || l.muted || !l.core.Enabled(InfoLevel) {
 		return
 	}
-	l.zap.Infow(msg, kvs...)
+	l.zap.Infow(msg, l.prepare(InfoLevel, kvs)...)
 }
 
 func (l *logger) Infof(template string, args ...any) {
-	if l.zap == nil || l.muted {
+	if l.zap == nil || l.muted || !l.core.Enabled(InfoLevel) {
 		return
 	}
-	l.zap.Infof(template, args...)
+	l.zap.Infof(template, l.prepareArgs(args)...)
 }
 
 func (l *logger) Warn(msg string, kvs ...any) {
-	if l.zap == nil || l.muted {
+	if l.zap == nil || l.muted || !l.core.Enabled(WarnLevel) {
 		return
 	}
-	l.zap.Warnw(msg, kvs...)
+	l.zap.Warnw(msg, l.prepare(WarnLevel, kvs)...)
 }
 
 func (l *logger) Warnf(template string, args ...any) {
-	if l.zap == nil || l.muted {
+	if l.zap == nil || l.muted || !l.core.Enabled(WarnLevel) {
 		return
 	}
-	l.zap.Warnf(template, args...)
+	l.zap.Warnf(template, l.prepareArgs(args)...)
 }
 
 func (l *logger) Error(msg string, kvs ...any) {
-	if l.zap == nil || l.muted {
+	if l.zap == nil || l.muted || !l.core.Enabled(ErrorLevel) {
 		return
 	}
-	l.zap.Errorw(msg, kvs...)
+	l.zap.Errorw(msg, l.prepare(ErrorLevel, kvs)...)
 }
 
 func (l *logger) Errorf(template string, args ...any) {
-	if l.zap == nil || l.muted {
+	if l.zap == nil || l.muted || !l.core.Enabled(ErrorLevel) {
 		return
 	}
-	l.zap.Errorf(template, args...)
+	l.zap.Errorf(template, l.prepareArgs(args)...)
 }
 
 func (l *logger) Panic(msg string, kvs ...any) {
 	if l.zap == nil || l.muted {
 		return
 	}
-	l.zap.Panicw(msg, kvs...)
+	l.zap.Panicw(msg, l.prepare(PanicLevel, kvs)...)
 }
 
 func (l *logger) Panicf(template string, args ...any) {
 	if l.zap == nil || l.muted {
 		return
 	}
-	l.zap.Panicf(template, args...)
+	l.zap.Panicf(template, l.prepareArgs(args)...)
 }
 
 func (l *logger) Fatal(msg string, kvs ...any) {
 	if l.zap == nil || l.muted {
 		return
 	}
-	l.zap.Fatalw(msg, kvs...)
+	l.zap.Fatalw(msg, l.prepare(FatalLevel, kvs)...)
 }
 
 func (l *logger) Fatalf(template string, args ...any) {
 	if l.zap == nil || l.muted {
 		return
 	}
-	l.zap.Fatalf(template, args...)
+	l.zap.Fatalf(template, l.prepareArgs(args)...)
+}
+
+// prepare apply error fields, lazy wrapper and redaction to kvs before passing them to zap,
+// callers should check the level first, so that disabled levels pay nothing for it
+func (l *logger) prepare(level Level, kvs []any) []any {
+	var kvs2, found = errorKVs(kvs)
+	if found && level >= ErrorLevel && _errorStacktrace.Load() {
+		// skip prepare itself, the rest frames are the same as caller skip of zap
+		kvs2 = append(kvs2, zap.StackSkip("stacktrace", 1+l.skip))
+	}
+	return redactKVs(l.name, lazyKVs(kvs2))
+}
+
+// prepareArgs apply redaction to template args before passing them to zap
+func (l *logger) prepareArgs(args []any) []any {
+	return redactArgs(l.name, args)
 }
 
 func (l *logger) With(kvs ...any) Logger {
 	var l2 = l.fork(0, "", "")
 	if len(kvs) > 0 {
+		kvs = l2.prepare(InfoLevel, kvs)
 		l2.with = append(l2.with, kvs...)
 		l2.zap = l2.zap.With(kvs...)
 	}
 	return l2
 }
 
+func (l *logger) WithLevel(level Level) Logger {
+	var base = *l
+	if base.zap0 != nil {
+		base.zap0 = base.zap0.WithOptions(zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+			return &levelCore{Core: core, level: level}
+		}))
+	}
+	return base.fork(0, "", "")
+}
+
 func (l *logger) Sync() error {
 	if l.zap == nil {
 		return nil
@@ -277,3 +339,39 @@ func (l *logger) Mute() {
 func (l *logger) Unmute() {
 	l.muted = false
 }
+
+// levelCore overrides the minimum level of the wrapped core.
+// If the level is lower than the wrapped one, entries are checked by the wrapped core
+// with the level raised to its minimum, so sampling and rate limiting still apply,
+// and then written with their original level.
+type levelCore struct {
+	zapcore.Core
+	level zapcore.Level
+}
+
+func (c *levelCore) Enabled(lvl zapcore.Level) bool {
+	return lvl >= c.level
+}
+
+func (c *levelCore) Level() zapcore.Level {
+	return c.level
+}
+
+func (c *levelCore) With(fields []zapcore.Field) zapcore.Core {
+	return &levelCore{Core: c.Core.With(fields), level: c.level}
+}
+
+func (c *levelCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if ent.Level < c.level {
+		return ce
+	}
+	if c.Core.Enabled(ent.Level) {
+		return c.Core.Check(ent, ce)
+	}
+	var raised = ent
+	raised.Level = zapcore.LevelOf(c.Core)
+	if ce = c.Core.Check(raised, ce); ce != nil {
+		ce.Entry.Level = ent.Level
+	}
+	return ce
+}
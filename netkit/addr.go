@@ -56,6 +56,50 @@ func AddrCompletion(raw string, ip net.IP, port uint16) (string, error) {
 	return net.JoinHostPort(rawhost, rawport), nil
 }
 
+// NormalizeAddr 将给定的地址转换为统一的格式，可以用作同一个地址的唯一标识。
+// 会移除grpc风格的scheme前缀(如dns:///)，主机名转为小写并移除末尾的点，ip转为标准格式，
+// 端口移除前导0，端口缺失时如果给定了port>0则补全。无法解析时返回去除空白并转为小写的原值。
+// "DNS:///Svc.Local.:08080" => svc.local:8080
+// "[0:0::1]:80"             => [::1]:80
+func NormalizeAddr(raw string, port uint16) string {
+	var addr = strings.ToLower(strings.TrimSpace(raw))
+	if i := strings.Index(addr, ":///"); i >= 0 {
+		addr = addr[i+4:]
+	} else if i := strings.Index(addr, "://"); i >= 0 {
+		addr = addr[i+3:]
+	}
+
+	var host, p, err = net.SplitHostPort(addr)
+	if err != nil {
+		// no port
+		host, p = strings.TrimSuffix(strings.TrimPrefix(addr, "["), "]"), ""
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		host = ip.String()
+	} else {
+		host = strings.TrimSuffix(host, ".")
+	}
+	if host == "" {
+		return addr
+	}
+
+	if p != "" {
+		var n, err = strconv.ParseUint(p, 10, 16)
+		if err != nil {
+			return addr
+		}
+		p = strconv.FormatUint(n, 10)
+	} else if port > 0 {
+		p = strconv.FormatUint(uint64(port), 10)
+	} else {
+		if strings.IndexByte(host, ':') >= 0 {
+			return "[" + host + "]"
+		}
+		return host
+	}
+	return net.JoinHostPort(host, p)
+}
+
 // ResolveTCPAddr use AddrCompletion to resolve the raw as a tcp address
 func ResolveTCPAddr(raw string, ip net.IP, port uint16) (*net.TCPAddr, error) {
 	if addr, err := AddrCompletion(raw, ip, port); err != nil {
@@ -16,3 +16,22 @@ func TestUniqCSVAddrs(t *testing.T) {
 	var str = PrettyCSVAddr(2181, "127.0.0.1:2181")
 	t.Log("str " + str)
 }
+
+func TestNormalizeAddr(t *testing.T) {
+	for _, c := range []struct {
+		raw    string
+		port   uint16
+		expect string
+	}{
+		{"DNS:///Svc.Local.:08080", 0, "svc.local:8080"},
+		{"[0:0::1]:80", 0, "[::1]:80"},
+		{" 127.0.0.1 ", 443, "127.0.0.1:443"},
+		{"::1", 0, "[::1]"},
+		{"http://Example.com", 80, "example.com:80"},
+		{"example.com:x", 0, "example.com:x"},
+	} {
+		if addr := NormalizeAddr(c.raw, c.port); addr != c.expect {
+			t.Errorf("NormalizeAddr(%q, %d): expect %q, got %q", c.raw, c.port, c.expect, addr)
+		}
+	}
+}
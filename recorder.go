@@ -0,0 +1,151 @@
+package xiao
+
+import (
+	gcontext "context"
+	"sync"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// DefaultRecorderSize 是飞行记录模式下，每个session默认最多缓存的日志条数
+const DefaultRecorderSize = 256
+
+// RecordedSessionalContext 返回一个开启了飞行记录模式的SessionalContext。
+// 该模式下，低于当前日志等级的debug等日志不会被直接丢弃，而是被缓存在一个有界的缓冲区当中，
+// 缓冲区满时会丢弃最早的记录。一旦该session或其任意Fork输出了Error及以上等级的日志，
+// 缓冲区内的日志会先按原有顺序被输出。
+// 返回的函数用于在请求正常结束时丢弃缓冲区，之后的低等级日志也不再被缓存。
+// size <= 0 时使用DefaultRecorderSize。
+func RecordedSessionalContext(size int, prefix ...string) (Context, func()) {
+	return newRecordedContext(gcontext.Background(), newSessionName(prefix...), size)
+}
+
+// ToRecordedSessionalContext 与RecordedSessionalContext相同，但使用给定的标准库Context作为内部基础对象。
+func ToRecordedSessionalContext(gctx gcontext.Context, size int, prefix ...string) (Context, func()) {
+	return newRecordedContext(gctx, newSessionName(prefix...), size)
+}
+
+func newRecordedContext(gctx gcontext.Context, name string, size int) (Context, func()) {
+	var rec = newFlightRecorder(size)
+	var z0 = _S.WithOptions(zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+		return &recorderCore{Core: core, rec: rec}
+	}))
+	return tracked(NewContext(gctx, NewEnv(), NewLogger(name, "", z0, nil, nil))), rec.drop
+}
+
+type recordedEntry struct {
+	core   zapcore.Core
+	entry  zapcore.Entry
+	fields []zapcore.Field
+}
+
+// flightRecorder 是一个环形缓冲区，同一个session及其所有Fork共享同一个实例
+type flightRecorder struct {
+	mu      sync.Mutex
+	entries []recordedEntry
+	head    int
+	count   int
+	dropped bool
+}
+
+func newFlightRecorder(size int) *flightRecorder {
+	if size <= 0 {
+		size = DefaultRecorderSize
+	}
+	return &flightRecorder{entries: make([]recordedEntry, size)}
+}
+
+func (r *flightRecorder) active() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return !r.dropped
+}
+
+func (r *flightRecorder) record(e recordedEntry) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.dropped {
+		return
+	}
+	var size = len(r.entries)
+	r.entries[(r.head+r.count)%size] = e
+	if r.count < size {
+		r.count++
+	} else {
+		// full, overwrite the oldest one
+		r.head = (r.head + 1) % size
+	}
+}
+
+func (r *flightRecorder) take() []recordedEntry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.count == 0 {
+		return nil
+	}
+	var size = len(r.entries)
+	var list = make([]recordedEntry, r.count)
+	for i := range list {
+		var idx = (r.head + i) % size
+		list[i] = r.entries[idx]
+		r.entries[idx] = recordedEntry{}
+	}
+	r.head, r.count = 0, 0
+	return list
+}
+
+func (r *flightRecorder) flush() {
+	for _, e := range r.take() {
+		e.core.Write(e.entry, e.fields)
+	}
+}
+
+func (r *flightRecorder) drop() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.dropped = true
+	r.entries = make([]recordedEntry, len(r.entries))
+	r.head, r.count = 0, 0
+}
+
+// recorderCore 拦截未被启用的低等级日志并缓存，在遇到Error及以上等级时先行输出缓存
+type recorderCore struct {
+	zapcore.Core
+	rec *flightRecorder
+}
+
+func (c *recorderCore) Enabled(lvl zapcore.Level) bool {
+	if c.Core.Enabled(lvl) {
+		return true
+	}
+	return lvl < zapcore.ErrorLevel && c.rec.active()
+}
+
+func (c *recorderCore) With(fields []zapcore.Field) zapcore.Core {
+	return &recorderCore{Core: c.Core.With(fields), rec: c.rec}
+}
+
+func (c *recorderCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Core.Enabled(ent.Level) {
+		if ent.Level >= zapcore.ErrorLevel {
+			c.rec.flush()
+		}
+		return c.Core.Check(ent, ce)
+	}
+	if ent.Level < zapcore.ErrorLevel && c.rec.active() {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *recorderCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	if c.Core.Enabled(ent.Level) {
+		if ent.Level >= zapcore.ErrorLevel {
+			c.rec.flush()
+		}
+		return c.Core.Write(ent, fields)
+	}
+	c.rec.record(recordedEntry{core: c.Core, entry: ent, fields: fields})
+	return nil
+}
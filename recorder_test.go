@@ -0,0 +1,42 @@
+package xiao
+
+import (
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestRecordedSessionalContext(t *testing.T) {
+	var core, logs = observer.New(zapcore.InfoLevel)
+	defer ReplaceLogger(zap.New(core))()
+
+	var ctx, end = RecordedSessionalContext(2)
+	ctx.Debug("debug 1")
+	ctx.Debug("debug 2")
+	ctx.Fork().Debug("debug 3")
+	ctx.Info("info")
+	if n := logs.Len(); n != 1 {
+		t.Fatalf("expect only 1 entry before error, got %d", n)
+	}
+	ctx.Error("error")
+
+	var expect = []string{"info", "debug 2", "debug 3", "error"}
+	var got = logs.TakeAll()
+	if len(got) != len(expect) {
+		t.Fatalf("expect %d entries, got %d", len(expect), len(got))
+	}
+	for i := range expect {
+		if got[i].Message != expect[i] {
+			t.Errorf("entry %d: expect %q, got %q", i, expect[i], got[i].Message)
+		}
+	}
+
+	ctx.Debug("debug 4")
+	end()
+	ctx.Error("error")
+	if got := logs.TakeAll(); len(got) != 1 || got[0].Message != "error" {
+		t.Errorf("buffer should be dropped after end, got %d entries", len(got))
+	}
+}
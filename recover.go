@@ -0,0 +1,87 @@
+package xiao
+
+import (
+	gcontext "context"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/cjey/xiao/gerror"
+	"google.golang.org/grpc"
+)
+
+// recovered 输出panic的值和调用栈，并返回对应的Internal错误
+func recovered(ctx Context, p any) *gerror.GError {
+	ctx.Error("panic recovered", "panic", p, "stack", string(debug.Stack()))
+	return gerror.Grpc(gerror.GrpcInternal, "panic: %v", p)
+}
+
+// Safe 执行fn，fn发生panic时会被恢复，并返回grpc Internal类型的*gerror.GError
+func Safe(ctx Context, fn func(Context) error) (err error) {
+	defer ctx.Recover(&err)
+	return fn(ctx)
+}
+
+// contextOf 如果gctx本身就是Context则直接使用，否则为其创建一个SessionalContext
+func contextOf(gctx gcontext.Context, location string) Context {
+	if ctx, ok := gctx.(Context); ok {
+		return ctx.At(location)
+	}
+	return ToSessionalContext(gctx).At(location)
+}
+
+// UnaryRecoveryInterceptor 返回一个恢复panic的grpc一元拦截器，
+// 请求的Context会被替换为位于FullMethod的SessionalContext，handler中可以直接断言为Context使用，
+// panic时返回编码后的grpc Internal错误
+func UnaryRecoveryInterceptor() grpc.UnaryServerInterceptor {
+	return func(gctx gcontext.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp any, err error) {
+		var ctx = contextOf(gctx, info.FullMethod)
+		defer func() {
+			if p := recover(); p != nil {
+				resp, err = nil, recovered(ctx, p).Err()
+			}
+		}()
+		return handler(ctx, req)
+	}
+}
+
+// recoveredStream 使用Context替换原有stream的Context
+type recoveredStream struct {
+	grpc.ServerStream
+	ctx Context
+}
+
+func (s *recoveredStream) Context() gcontext.Context {
+	return s.ctx
+}
+
+// StreamRecoveryInterceptor 返回一个恢复panic的grpc流式拦截器，行为与UnaryRecoveryInterceptor相同
+func StreamRecoveryInterceptor() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+		var ctx = contextOf(ss.Context(), info.FullMethod)
+		defer func() {
+			if p := recover(); p != nil {
+				err = recovered(ctx, p).Err()
+			}
+		}()
+		return handler(srv, &recoveredStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+// RecoveryHandler 返回一个恢复panic的http中间件，
+// 请求的Context会被替换为位于URL.Path的SessionalContext，handler中可以通过r.Context().(Context)获取，
+// panic时返回500。http.ErrAbortHandler会被继续抛出。
+func RecoveryHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var ctx = contextOf(r.Context(), r.URL.Path)
+		defer func() {
+			if p := recover(); p != nil {
+				if p == http.ErrAbortHandler {
+					panic(p)
+				}
+				recovered(ctx, p)
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			}
+		}()
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
@@ -0,0 +1,107 @@
+package xiao
+
+import (
+	gcontext "context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cjey/xiao/gerror"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type fakeServerStream struct {
+	grpc.ServerStream
+	ctx gcontext.Context
+}
+
+func (s *fakeServerStream) Context() gcontext.Context {
+	return s.ctx
+}
+
+func TestRecover(t *testing.T) {
+	var path = filepath.Join(t.TempDir(), "recover.log")
+	var logger, err = NewSimpleLogger("info", path, "json", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ReplaceLogger(logger)()
+
+	var ctx = NamedContext("TestRecover").At("Safe")
+	err = Safe(ctx, func(Context) error { panic("boom") })
+	var gerr *gerror.GError
+	if !errors.As(err, &gerr) || !gerr.Equal(codes.Internal) || gerr.Message != "panic: boom" {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err = Safe(ctx, func(Context) error { return errors.New("normal") }); err.Error() != "normal" {
+		t.Errorf("unexpected error: %v", err)
+	}
+	func() {
+		defer ctx.Recover()
+		panic("no errp")
+	}()
+
+	// grpc
+	var resp, uerr = UnaryRecoveryInterceptor()(gcontext.Background(), nil, &grpc.UnaryServerInfo{FullMethod: "/svc/Unary"},
+		func(gctx gcontext.Context, req any) (any, error) {
+			if gctx.(Context).Location() != "/svc/Unary" {
+				t.Errorf("unexpected location: %s", gctx.(Context).Location())
+			}
+			panic("unary")
+		})
+	if resp != nil || status.Code(uerr) != codes.Internal {
+		t.Errorf("unexpected unary result: %v, %v", resp, uerr)
+	}
+	var serr = StreamRecoveryInterceptor()(nil, &fakeServerStream{ctx: NamedContext("Stream")}, &grpc.StreamServerInfo{FullMethod: "/svc/Stream"},
+		func(srv any, ss grpc.ServerStream) error {
+			if ctx := ss.Context().(Context); ctx.Name() != "Stream" || ctx.Location() != "/svc/Stream" {
+				t.Errorf("unexpected stream context: %s @%s", ctx.Name(), ctx.Location())
+			}
+			panic("stream")
+		})
+	if status.Code(serr) != codes.Internal || status.Convert(serr).Message() != "panic: stream" {
+		t.Errorf("unexpected stream result: %v", serr)
+	}
+
+	// http
+	var h = RecoveryHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := r.Context().(Context); !ok {
+			t.Errorf("request context should be a Context")
+		}
+		panic("http")
+	}))
+	var rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/api/x", nil))
+	if rec.Code != 500 {
+		t.Errorf("unexpected code: %d", rec.Code)
+	}
+	func() {
+		defer func() {
+			if p := recover(); p != http.ErrAbortHandler {
+				t.Errorf("ErrAbortHandler should be repanicked: %v", p)
+			}
+		}()
+		RecoveryHandler(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+			panic(http.ErrAbortHandler)
+		})).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	}()
+
+	logger.Sync()
+	var b, _ = os.ReadFile(path)
+	var lines = strings.Split(strings.TrimSpace(string(b)), "\n")
+	if len(lines) != 5 {
+		t.Fatalf("expect 5 lines, got %d: %s", len(lines), b)
+	}
+	if !strings.Contains(lines[0], `"N":"TestRecover","M":"panic recovered","@":"Safe","panic":"boom","stack":"goroutine `) {
+		t.Errorf("unexpected log: %s", lines[0])
+	}
+	if !strings.Contains(lines[4], `"@":"/api/x","panic":"http"`) {
+		t.Errorf("unexpected log: %s", lines[4])
+	}
+}
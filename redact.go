@@ -0,0 +1,264 @@
+package xiao
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Redacted 可以由日志参数的值来实现，输出日志时会使用Redacted()的返回值替代原值
+type Redacted interface {
+	Redacted() any
+}
+
+// DefaultRedactMask 是脱敏时默认使用的掩码
+const DefaultRedactMask = "******"
+
+// RedactRules 定义了一组日志脱敏规则，作用于Logger的kvs参数以及格式化参数
+type RedactRules struct {
+	// Keys 按key名称匹配，命中时整个值被替换为Mask
+	Keys []*regexp.Regexp
+	// Values 按值匹配，仅作用于字符串类型的值，命中的部分被替换为Mask
+	Values []*regexp.Regexp
+	// Mask 为空时使用DefaultRedactMask
+	Mask string
+}
+
+// _cardNumberRE 匹配可能的信用卡号，还需要通过Luhn校验，以免误伤时间戳和各种数字ID
+var _cardNumberRE = regexp.MustCompile(`\b\d{4}[ -]?\d{4}[ -]?\d{4}[ -]?\d{1,7}\b`)
+
+// DefaultRedactRules 返回一组常用的脱敏规则，
+// 包括password、token、authorization等key名称，以及通过Luhn校验的信用卡号和bearer token的值
+func DefaultRedactRules() *RedactRules {
+	return &RedactRules{
+		Keys: []*regexp.Regexp{
+			regexp.MustCompile(`(?i)passw(or)?d|secret|token|authorization|api[-_]?key|cookie`),
+		},
+		Values: []*regexp.Regexp{
+			_cardNumberRE,
+			regexp.MustCompile(`(?i)\bbearer\s+[a-z0-9._~+/-]+=*`),
+		},
+	}
+}
+
+var _redact struct {
+	mu     sync.RWMutex
+	global *RedactRules
+	named  map[string]*RedactRules
+}
+
+// SetRedactRules 设置全局的脱敏规则，nil表示关闭脱敏，返回的函数用于恢复之前的规则。
+// 无论是否设置了规则，实现了Redacted接口的值总会被替换。
+func SetRedactRules(rules *RedactRules) func() {
+	_redact.mu.Lock()
+	defer _redact.mu.Unlock()
+	var prev = _redact.global
+	_redact.global = rules
+	return func() { SetRedactRules(prev) }
+}
+
+// SetNamedRedactRules 为指定名称的logger及其所有Fork设置脱敏规则，覆盖全局规则，
+// 例如name为"UserService"时，会作用于"UserService"和"UserService.1"，有多个匹配时使用最长的那个。
+// rules为nil表示删除覆盖，返回的函数用于恢复之前的规则。
+func SetNamedRedactRules(name string, rules *RedactRules) func() {
+	_redact.mu.Lock()
+	defer _redact.mu.Unlock()
+	var prev, ok = _redact.named[name]
+	if rules == nil {
+		delete(_redact.named, name)
+	} else {
+		if _redact.named == nil {
+			_redact.named = make(map[string]*RedactRules)
+		}
+		_redact.named[name] = rules
+	}
+	return func() {
+		if ok {
+			SetNamedRedactRules(name, prev)
+		} else {
+			SetNamedRedactRules(name, nil)
+		}
+	}
+}
+
+// redactRulesFor 返回给定名称实际生效的规则
+func redactRulesFor(name string) *RedactRules {
+	_redact.mu.RLock()
+	defer _redact.mu.RUnlock()
+	var rules, matched = _redact.global, -1
+	for k, r := range _redact.named {
+		if name == k || strings.HasPrefix(name, k+".") {
+			if len(k) > matched {
+				rules, matched = r, len(k)
+			}
+		}
+	}
+	return rules
+}
+
+func (r *RedactRules) mask() string {
+	if r.Mask == "" {
+		return DefaultRedactMask
+	}
+	return r.Mask
+}
+
+func (r *RedactRules) matchKey(key string) bool {
+	if r == nil {
+		return false
+	}
+	for _, re := range r.Keys {
+		if re.MatchString(key) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *RedactRules) redactString(s string) string {
+	if r == nil {
+		return s
+	}
+	for _, re := range r.Values {
+		if re == _cardNumberRE {
+			s = re.ReplaceAllStringFunc(s, func(m string) string {
+				if luhnValid(m) {
+					return r.mask()
+				}
+				return m
+			})
+			continue
+		}
+		s = re.ReplaceAllLiteralString(s, r.mask())
+	}
+	return s
+}
+
+// luhnValid 对s中的数字执行Luhn校验，忽略其他字符
+func luhnValid(s string) bool {
+	var sum, n int
+	for i := len(s) - 1; i >= 0; i-- {
+		var c = s[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		var d = int(c - '0')
+		if n%2 == 1 {
+			if d *= 2; d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		n++
+	}
+	return n > 0 && sum%10 == 0
+}
+
+// redactValue 返回脱敏后的值，以及值是否被改变
+func (r *RedactRules) redactValue(val any) (any, bool) {
+	switch v := val.(type) {
+	case Redacted:
+		return v.Redacted(), true
+	case Lazy:
+		if r == nil {
+			return val, false
+		}
+		return Lazy(func() any {
+			var val, _ = r.redactValue(v())
+			return val
+		}), true
+	case *lazyValue:
+		if r == nil {
+			return val, false
+		}
+		return &lazyValue{f: func() any {
+			var val, _ = r.redactValue(v.value())
+			return val
+		}}, true
+	case string:
+		if s := r.redactString(v); s != v {
+			return s, true
+		}
+	}
+	return val, false
+}
+
+func (r *RedactRules) redactField(f zapcore.Field) (zapcore.Field, bool) {
+	if r.matchKey(f.Key) {
+		return zap.String(f.Key, r.mask()), true
+	}
+	if v, ok := f.Interface.(Redacted); ok {
+		return zap.Any(f.Key, v.Redacted()), true
+	}
+	if f.Type == zapcore.StringType {
+		if s := r.redactString(f.String); s != f.String {
+			return zap.String(f.Key, s), true
+		}
+	}
+	return f, false
+}
+
+// redactKVs 对sugar风格的kvs执行脱敏，只在有改动时才会复制
+func redactKVs(name string, kvs []any) []any {
+	if len(kvs) == 0 {
+		return kvs
+	}
+	var (
+		rules = redactRulesFor(name)
+		out   []any
+		set   = func(i int, v any) {
+			if out == nil {
+				out = make([]any, len(kvs))
+				copy(out, kvs)
+			}
+			out[i] = v
+		}
+	)
+	for i := 0; i < len(kvs); i++ {
+		switch key := kvs[i].(type) {
+		case zapcore.Field:
+			if f, changed := rules.redactField(key); changed {
+				set(i, f)
+			}
+		case string:
+			if i+1 >= len(kvs) {
+				break
+			}
+			i++
+			if rules.matchKey(key) {
+				set(i, rules.mask())
+			} else if v, changed := rules.redactValue(kvs[i]); changed {
+				set(i, v)
+			}
+		}
+	}
+	if out == nil {
+		return kvs
+	}
+	return out
+}
+
+// redactArgs 对格式化参数执行脱敏，只在有改动时才会复制
+func redactArgs(name string, args []any) []any {
+	if len(args) == 0 {
+		return args
+	}
+	var rules = redactRulesFor(name)
+	var out []any
+	for i := range args {
+		if v, changed := rules.redactValue(args[i]); changed {
+			if out == nil {
+				out = make([]any, len(args))
+				copy(out, args)
+			}
+			out[i] = v
+		}
+	}
+	if out == nil {
+		return args
+	}
+	return out
+}
@@ -0,0 +1,96 @@
+package xiao
+
+import (
+	"regexp"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+type secretPhone string
+
+func (p secretPhone) Redacted() any {
+	return string(p[:3]) + "****" + string(p[len(p)-4:])
+}
+
+func TestRedact(t *testing.T) {
+	var core, logs = observer.New(zapcore.DebugLevel)
+	defer ReplaceLogger(zap.New(core))()
+	defer SetRedactRules(DefaultRedactRules())()
+	defer SetNamedRedactRules("plain", &RedactRules{})()
+
+	var ctx = NamedContext("TestRedact")
+	ctx.Logger().With("Authorization", "Bearer abc.def").Info("with")
+	ctx.Info("kvs",
+		"password", "123456",
+		"card", "pay by 4111 1111 1111 1111 ok",
+		"ids", "at 1700000000000 order 4111111111111112 card 4111111111111111",
+		"phone", secretPhone("13800138000"),
+		zap.String("token", "xyz"),
+	)
+	ctx.Infof("phone %s", secretPhone("13800138000"))
+	NamedContext("plain").Fork().Info("plain", "password", "123456", "phone", secretPhone("13800138000"))
+
+	var got = logs.TakeAll()
+	var expect = []map[string]any{
+		{"Authorization": DefaultRedactMask},
+		{
+			"password": DefaultRedactMask,
+			"card":     "pay by " + DefaultRedactMask + " ok",
+			"ids":      "at 1700000000000 order 4111111111111112 card " + DefaultRedactMask,
+			"phone":    "138****8000",
+			"token":    DefaultRedactMask,
+		},
+		nil,
+		{"password": "123456", "phone": "138****8000"},
+	}
+	for i := range expect {
+		var fields = got[i].ContextMap()
+		for k, v := range expect[i] {
+			if fields[k] != v {
+				t.Errorf("entry %d: expect %s=%v, got %v", i, k, v, fields[k])
+			}
+		}
+	}
+	if got[2].Message != "phone 138****8000" {
+		t.Errorf("template args should be redacted, got %q", got[2].Message)
+	}
+
+	defer SetNamedRedactRules("plain", &RedactRules{
+		Keys: []*regexp.Regexp{regexp.MustCompile(`^pin$`)},
+		Mask: "x",
+	})()
+	NamedContext("plain").Info("pin", "pin", "0000")
+	if v := logs.TakeAll()[0].ContextMap()["pin"]; v != "x" {
+		t.Errorf("named rules should override, got %v", v)
+	}
+}
+
+type countedRedacted struct {
+	calls *int
+}
+
+func (c countedRedacted) Redacted() any {
+	*c.calls++
+	return "redacted"
+}
+
+func TestRedactDisabledLevel(t *testing.T) {
+	var core, logs = observer.New(zapcore.InfoLevel)
+	defer ReplaceLogger(zap.New(core))()
+	defer SetRedactRules(DefaultRedactRules())()
+
+	var calls int
+	var ctx = NamedContext("TestRedactDisabledLevel")
+	ctx.Debug("dropped", "v", countedRedacted{&calls}, "password", "123456")
+	ctx.Debugf("dropped %v", countedRedacted{&calls})
+	if calls != 0 || logs.Len() != 0 {
+		t.Errorf("disabled level should not be prepared, calls=%d", calls)
+	}
+	ctx.Info("written", "v", countedRedacted{&calls})
+	if calls != 1 || logs.Len() != 1 {
+		t.Errorf("enabled level should be prepared, calls=%d", calls)
+	}
+}
@@ -0,0 +1,322 @@
+package xiao
+
+import (
+	"cmp"
+	gcontext "context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Registry 记录所有存活的SessionalContext，以及由它们Fork/At/WithX派生出来的子Context，
+// 用于在服务卡住时查看有哪些请求正在执行，以及它们各自执行到了哪里。
+// Context在被取消、调用End()或者被GC回收之后，会自动从Registry中移除，
+// 子Context存活时，父Context即使被回收也会保留在Registry中。
+type Registry struct {
+	mu    sync.Mutex
+	seq   uint64
+	roots map[*ctxNode]struct{}
+}
+
+// NewRegistry 返回一个空的Registry，需要通过UseRegistry启用
+func NewRegistry() *Registry {
+	return &Registry{roots: make(map[*ctxNode]struct{})}
+}
+
+var _registry atomic.Pointer[Registry]
+
+// UseRegistry 启用给定的Registry，之后创建的SessionalContext都会被记录，nil表示关闭，
+// 返回的函数用于恢复之前的Registry。已经创建的Context不受影响。
+func UseRegistry(r *Registry) func() {
+	var prev = _registry.Swap(r)
+	return func() { UseRegistry(prev) }
+}
+
+// ContextInfo 是Registry中一个Context的快照
+type ContextInfo struct {
+	Name     string         `json:"name"`
+	Location string         `json:"location,omitempty"`
+	Start    time.Time      `json:"start"`
+	Age      time.Duration  `json:"age"`
+	Deadline time.Time      `json:"deadline,omitzero"`
+	Origin   string         `json:"origin,omitempty"`
+	EnvKeys  []string       `json:"env_keys,omitempty"`
+	Children []*ContextInfo `json:"children,omitempty"`
+}
+
+// ctxNode 是Registry中的一个节点，同一个节点可能被多个派生出的Context共享，
+// 比如WithValue，每个子节点也会持有父节点的一个引用，
+// 只有所有共享者都被回收、并且所有子节点都已移除后，节点才会因GC而移除
+type ctxNode struct {
+	reg    *Registry
+	parent *ctxNode
+	seq    uint64
+
+	name     string
+	location string
+	origin   string // where a detached root was derived from, see detach
+	start    time.Time
+	gctx     gcontext.Context
+	env      Env
+
+	// guarded by reg.mu
+	children map[*ctxNode]struct{}
+	ended    bool
+	refs     int
+	stop     func() bool
+}
+
+// tracked 将SessionalContext作为根节点记录到当前启用的Registry中
+func tracked(ctx Context) Context {
+	if c, ok := ctx.(*context); ok {
+		c.track(_registry.Load(), nil, "")
+	}
+	return ctx
+}
+
+// child 将newctx作为ctx的子节点记录，ctx未被记录时什么也不做
+func (ctx *context) child(newctx *context) {
+	if ctx.node != nil {
+		newctx.track(ctx.node.reg, ctx.node, "")
+	}
+}
+
+// detach 将newctx作为新的根节点记录，用于Reborn等脱离ctx生命周期的派生，
+// 这样ctx结束后newctx仍然可见，并通过origin记录它是从哪里派生的
+func (ctx *context) detach(newctx *context) {
+	if ctx.node != nil {
+		var origin = ctx.node.name
+		if ctx.node.location != "" {
+			origin += " @" + ctx.node.location
+		}
+		newctx.track(ctx.node.reg, nil, origin)
+	}
+}
+
+// share 让newctx与ctx共享同一个节点，用于不需要单独展示的派生，比如WithValue
+func (ctx *context) share(newctx *context) {
+	if ctx.node != nil {
+		newctx.node = ctx.node
+		ctx.node.retain(newctx)
+	}
+}
+
+// track 为ctx创建一个节点，parent为nil时作为根节点
+func (ctx *context) track(reg *Registry, parent *ctxNode, origin string) {
+	if reg == nil {
+		return
+	}
+
+	var node = &ctxNode{
+		reg:      reg,
+		parent:   parent,
+		name:     ctx.Name(),
+		location: ctx.Location(),
+		origin:   origin,
+		start:    time.Now(),
+		gctx:     ctx.gctx,
+		env:      ctx.env,
+	}
+
+	reg.mu.Lock()
+	if parent != nil && parent.ended {
+		reg.mu.Unlock()
+		return
+	}
+	reg.seq++
+	node.seq = reg.seq
+	if parent != nil {
+		if parent.children == nil {
+			parent.children = make(map[*ctxNode]struct{})
+		}
+		parent.children[node] = struct{}{}
+		// released when node ends, see end
+		parent.refs++
+	} else {
+		reg.roots[node] = struct{}{}
+	}
+	reg.mu.Unlock()
+
+	var stop = gcontext.AfterFunc(ctx.gctx, node.end)
+	reg.mu.Lock()
+	node.stop = stop
+	reg.mu.Unlock()
+
+	ctx.node = node
+	node.retain(ctx)
+}
+
+// retain 将ctx作为节点的共享者之一，ctx被回收时自动释放
+func (node *ctxNode) retain(ctx *context) {
+	node.reg.mu.Lock()
+	node.refs++
+	node.reg.mu.Unlock()
+	runtime.AddCleanup(ctx, (*ctxNode).release, node)
+}
+
+func (node *ctxNode) release() {
+	node.reg.mu.Lock()
+	defer node.reg.mu.Unlock()
+	node.releaseLocked()
+}
+
+func (node *ctxNode) releaseLocked() {
+	node.refs--
+	if node.refs <= 0 {
+		node.removeLocked()
+	}
+}
+
+// end 将节点及其所有子节点从Registry中移除
+func (node *ctxNode) end() {
+	if node == nil {
+		return
+	}
+	node.reg.mu.Lock()
+	defer node.reg.mu.Unlock()
+	node.removeLocked()
+}
+
+// removeLocked 将节点从父节点中摘除并结束整个子树，然后释放对父节点的引用
+func (node *ctxNode) removeLocked() {
+	if node.ended {
+		return
+	}
+	if node.parent != nil {
+		delete(node.parent.children, node)
+	} else {
+		delete(node.reg.roots, node)
+	}
+	node.endLocked()
+	if node.parent != nil {
+		node.parent.releaseLocked()
+	}
+}
+
+func (node *ctxNode) endLocked() {
+	node.ended = true
+	if node.stop != nil {
+		node.stop()
+	}
+	for child := range node.children {
+		child.endLocked()
+	}
+	node.children = nil
+}
+
+func (node *ctxNode) info(now time.Time) *ContextInfo {
+	var info = &ContextInfo{
+		Name:     node.name,
+		Location: node.location,
+		Origin:   node.origin,
+		Start:    node.start,
+		Age:      now.Sub(node.start),
+	}
+	info.Deadline, _ = node.gctx.Deadline()
+	for _, k := range node.env.Keys() {
+		info.EnvKeys = append(info.EnvKeys, envKeyString(k))
+	}
+	slices.Sort(info.EnvKeys)
+	for _, child := range sortedNodes(node.children) {
+		info.Children = append(info.Children, child.info(now))
+	}
+	return info
+}
+
+// envKeyString 返回Env key的可读形式，非字符串的key一般是私有类型，使用类型名称
+func envKeyString(k any) string {
+	switch v := k.(type) {
+	case string:
+		return v
+	case fmt.Stringer:
+		return v.String()
+	}
+	return fmt.Sprintf("%T", k)
+}
+
+func sortedNodes(set map[*ctxNode]struct{}) []*ctxNode {
+	var nodes = make([]*ctxNode, 0, len(set))
+	for node := range set {
+		nodes = append(nodes, node)
+	}
+	slices.SortFunc(nodes, func(a, b *ctxNode) int { return cmp.Compare(a.seq, b.seq) })
+	return nodes
+}
+
+// Dump 返回当前所有存活的SessionalContext及其子Context，按创建顺序排列
+func (r *Registry) Dump() []*ContextInfo {
+	var now = time.Now()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var infos = make([]*ContextInfo, 0, len(r.roots))
+	for _, node := range sortedNodes(r.roots) {
+		infos = append(infos, node.info(now))
+	}
+	return infos
+}
+
+// Len 返回当前存活的SessionalContext数量
+func (r *Registry) Len() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.roots)
+}
+
+// WriteTo 将Dump的结果以缩进的文本格式写入w
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	var (
+		infos = r.Dump()
+		now   = time.Now()
+		b     strings.Builder
+		write func(info *ContextInfo, depth int)
+	)
+	write = func(info *ContextInfo, depth int) {
+		b.WriteString(strings.Repeat("    ", depth))
+		b.WriteString(info.Name)
+		if info.Location != "" {
+			b.WriteString(" @")
+			b.WriteString(info.Location)
+		}
+		fmt.Fprintf(&b, " age=%s", info.Age.Round(time.Millisecond))
+		if !info.Deadline.IsZero() {
+			fmt.Fprintf(&b, " deadline=%s", info.Deadline.Sub(now).Round(time.Millisecond))
+		}
+		if len(info.EnvKeys) > 0 {
+			fmt.Fprintf(&b, " env=[%s]", strings.Join(info.EnvKeys, " "))
+		}
+		if info.Origin != "" {
+			fmt.Fprintf(&b, " origin=%q", info.Origin)
+		}
+		b.WriteByte('\n')
+		for _, child := range info.Children {
+			write(child, depth+1)
+		}
+	}
+	fmt.Fprintf(&b, "%d active sessions\n", len(infos))
+	for _, info := range infos {
+		b.WriteByte('\n')
+		write(info, 0)
+	}
+	var n, err = io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+// ServeHTTP 输出当前的Context树，默认为文本格式，?format=json时输出json
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.URL.Query().Get("format") == "json" {
+		w.Header().Set("Content-Type", "application/json")
+		var enc = json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(r.Dump())
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	r.WriteTo(w)
+}
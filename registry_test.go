@@ -0,0 +1,164 @@
+package xiao
+
+import (
+	gcontext "context"
+	"encoding/json"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRegistry(t *testing.T) {
+	var reg = NewRegistry()
+	defer UseRegistry(reg)()
+
+	var ctx = SessionalContext()
+	ctx.Set("user", "cjey")
+	var sub = ctx.ForkAt("Query")
+	var tctx, cancel = sub.WithTimeout(time.Minute)
+	tctx.WithValue("k", "v")
+	NamedContext("untracked").Fork()
+
+	var infos = reg.Dump()
+	if len(infos) != 1 {
+		t.Fatalf("expect 1 session, got %d", len(infos))
+	}
+	var root = infos[0]
+	if root.Name != ctx.Name() || len(root.EnvKeys) != 1 || root.EnvKeys[0] != "user" {
+		t.Errorf("unexpected root: %+v", root)
+	}
+	if len(root.Children) != 1 || root.Children[0].Location != "Query" || root.Children[0].Name != ctx.Name()+".1" {
+		t.Fatalf("unexpected children: %+v", root.Children)
+	}
+	var leaf = root.Children[0].Children
+	if len(leaf) != 1 || leaf[0].Deadline.IsZero() || len(leaf[0].Children) != 0 {
+		t.Fatalf("unexpected timeout child: %+v", leaf)
+	}
+
+	var rec = httptest.NewRecorder()
+	reg.ServeHTTP(rec, httptest.NewRequest("GET", "/debug/contexts", nil))
+	if s := rec.Body.String(); !strings.HasPrefix(s, "1 active sessions\n") ||
+		!strings.Contains(s, "\n    "+ctx.Name()+".1 @Query age=") ||
+		!strings.Contains(s, " deadline=") || !strings.Contains(s, " env=[user]") {
+		t.Errorf("unexpected text output: %s", s)
+	}
+	rec = httptest.NewRecorder()
+	reg.ServeHTTP(rec, httptest.NewRequest("GET", "/debug/contexts?format=json", nil))
+	var decoded []*ContextInfo
+	if err := json.Unmarshal(rec.Body.Bytes(), &decoded); err != nil || len(decoded) != 1 || decoded[0].Name != ctx.Name() {
+		t.Errorf("unexpected json output: %s", rec.Body)
+	}
+	runtime.KeepAlive(tctx)
+
+	// cancel removes the subtree
+	cancel()
+	var deadline = time.Now().Add(time.Second)
+	for len(reg.Dump()[0].Children[0].Children) != 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("canceled context should be removed")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	runtime.KeepAlive(sub)
+
+	ctx.End()
+	if reg.Len() != 0 {
+		t.Errorf("ended context should be removed")
+	}
+	// children of an ended context are not tracked
+	ctx.Fork()
+	if reg.Len() != 0 {
+		t.Errorf("unexpected tracked context")
+	}
+}
+
+func TestRegistryCleanup(t *testing.T) {
+	var reg = NewRegistry()
+	defer UseRegistry(reg)()
+
+	func() {
+		SessionalContext().At("Leak").WithValue("k", "v")
+	}()
+	if reg.Len() != 1 {
+		t.Fatalf("expect 1 session, got %d", reg.Len())
+	}
+	var deadline = time.Now().Add(5 * time.Second)
+	for reg.Len() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("unreachable context should be removed")
+		}
+		runtime.GC()
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestRegistryChildAlive(t *testing.T) {
+	var reg = NewRegistry()
+	defer UseRegistry(reg)()
+
+	// only the child is reachable, like contextOf does
+	var sub = func() Context {
+		return SessionalContext().At("Handle").ForkAt("Query")
+	}()
+	for range 3 {
+		runtime.GC()
+		time.Sleep(time.Millisecond)
+	}
+	var infos = reg.Dump()
+	if len(infos) != 1 || len(infos[0].Children) != 1 || infos[0].Children[0].Location != "Handle" ||
+		len(infos[0].Children[0].Children) != 1 {
+		t.Fatalf("parents of a live child should be kept: %+v", infos)
+	}
+	runtime.KeepAlive(sub)
+
+	sub = nil
+	var deadline = time.Now().Add(5 * time.Second)
+	for reg.Len() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("unreachable contexts should be removed")
+		}
+		runtime.GC()
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestRegistryReborn(t *testing.T) {
+	var reg = NewRegistry()
+	defer UseRegistry(reg)()
+
+	var gctx, cancel = gcontext.WithCancel(gcontext.Background())
+	var ctx = ToSessionalContext(gctx).At("Handle")
+	var reborn = ctx.Reborn()
+	var bg = reborn.At("Background")
+	if reg.Len() != 2 {
+		t.Fatalf("reborn context should be a new root, got %d roots", reg.Len())
+	}
+
+	cancel()
+	var deadline = time.Now().Add(time.Second)
+	for reg.Len() != 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("canceled request should be removed, got %d roots", reg.Len())
+		}
+		time.Sleep(time.Millisecond)
+	}
+	var infos = reg.Dump()
+	if infos[0].Origin != ctx.Name()+" @Handle" || len(infos[0].Children) != 1 ||
+		infos[0].Children[0].Location != "Handle/Background" {
+		t.Errorf("reborn context should still be listed: %+v", infos[0])
+	}
+	var b strings.Builder
+	reg.WriteTo(&b)
+	if !strings.Contains(b.String(), ` origin="`+ctx.Name()+` @Handle"`) {
+		t.Errorf("unexpected text output: %s", b.String())
+	}
+
+	reborn.End()
+	runtime.KeepAlive(bg)
+	if reg.Len() != 0 {
+		t.Errorf("ended context should be removed")
+	}
+}
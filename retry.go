@@ -0,0 +1,144 @@
+package xiao
+
+import (
+	"errors"
+	"math/rand/v2"
+	"strconv"
+	"time"
+
+	"github.com/cjey/xiao/gerror"
+	"google.golang.org/grpc/codes"
+)
+
+// RetryPolicy 定义了Retry的重试策略，零值字段使用默认值
+type RetryPolicy struct {
+	// MaxAttempts 最多尝试的次数，包括第一次，默认3
+	MaxAttempts int
+	// InitialBackoff 第一次重试前等待的时间，默认100ms
+	InitialBackoff time.Duration
+	// MaxBackoff 等待时间的上限，默认5s
+	MaxBackoff time.Duration
+	// Multiplier 每次重试后等待时间的增长倍数，默认2
+	Multiplier float64
+	// Jitter 等待时间的随机浮动比例，取值[0, 1]，默认0.2，小于0表示不浮动
+	Jitter float64
+	// AttemptTimeout 每次尝试的超时时间，为0时不单独限制，参见WithAttemptTimeout
+	AttemptTimeout time.Duration
+	// RetryBusiness 是否重试本地业务错误，默认不重试。全局业务错误总是不重试
+	RetryBusiness bool
+	// Retryable 自定义错误是否可以重试，设置后替代默认的判断规则
+	Retryable func(err error) bool
+}
+
+// DefaultRetryPolicy 是Retry使用的默认策略
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    3,
+	InitialBackoff: 100 * time.Millisecond,
+	MaxBackoff:     5 * time.Second,
+	Multiplier:     2,
+	Jitter:         0.2,
+}
+
+func (p RetryPolicy) withDefaults() RetryPolicy {
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = DefaultRetryPolicy.MaxAttempts
+	}
+	if p.InitialBackoff <= 0 {
+		p.InitialBackoff = DefaultRetryPolicy.InitialBackoff
+	}
+	if p.MaxBackoff <= 0 {
+		p.MaxBackoff = DefaultRetryPolicy.MaxBackoff
+	}
+	if p.Multiplier < 1 {
+		p.Multiplier = DefaultRetryPolicy.Multiplier
+	}
+	if p.Jitter == 0 {
+		p.Jitter = DefaultRetryPolicy.Jitter
+	} else if p.Jitter < 0 {
+		p.Jitter = 0
+	} else if p.Jitter > 1 {
+		p.Jitter = 1
+	}
+	return p
+}
+
+// backoff 返回第n次重试前需要等待的时间，n从1开始
+func (p RetryPolicy) backoff(n int) time.Duration {
+	var d = float64(p.InitialBackoff)
+	for i := 1; i < n && d < float64(p.MaxBackoff); i++ {
+		d *= p.Multiplier
+	}
+	d = min(d, float64(p.MaxBackoff))
+	if p.Jitter > 0 {
+		d *= 1 + p.Jitter*(2*rand.Float64()-1)
+	}
+	return time.Duration(d)
+}
+
+// retryable 判断err是否可以重试：
+// grpc的Unavailable、ResourceExhausted、DeadlineExceeded可以重试；
+// 本地业务错误只有在RetryBusiness时重试，全局业务错误不重试；
+// 单次尝试超时(AttemptTimeout)导致的DeadlineExceeded可以重试；其余错误不重试
+func (p RetryPolicy) retryable(err error) bool {
+	if p.Retryable != nil {
+		return p.Retryable(err)
+	}
+	if errors.Is(err, DeadlineExceeded) {
+		return true
+	}
+	var gerr = gerror.Decode(err)
+	if gerr.IsLocal() {
+		return p.RetryBusiness
+	}
+	if gerr.IsGlobal() {
+		return false
+	}
+	return gerr.Equal(codes.Unavailable) || gerr.Equal(codes.ResourceExhausted) || gerr.Equal(codes.DeadlineExceeded)
+}
+
+// Retry 按照policy执行fn，直到成功、遇到不可重试的错误、达到最大尝试次数，或者ctx结束，返回最后一次的错误。
+// 每次尝试都使用ctx.ForkAt("retry-N")，N从1开始，这样日志中可以区分每一次尝试。
+// 如果等待下一次重试会超出ctx的deadline，则不再重试。
+func Retry(ctx Context, policy RetryPolicy, fn func(Context) error) error {
+	policy = policy.withDefaults()
+	var err error
+	for attempt := 1; ; attempt++ {
+		var actx = ctx.ForkAt("retry-" + strconv.Itoa(attempt))
+		var cancel CancelFunc = func() {}
+		if policy.AttemptTimeout > 0 {
+			actx, cancel = WithAttemptTimeout(actx, policy.AttemptTimeout)
+		}
+		err = fn(actx)
+		cancel()
+		if err == nil {
+			return nil
+		}
+
+		if ctx.Err() != nil {
+			actx.Warn("attempt failed, context is done", "err", err, "cause", ctx.Cause())
+			return err
+		}
+		if !policy.retryable(err) {
+			actx.Warn("attempt failed, not retryable", "err", err)
+			return err
+		}
+		if attempt >= policy.MaxAttempts {
+			actx.Warn("attempt failed, no more attempts", "err", err, "attempts", attempt)
+			return err
+		}
+		var backoff = policy.backoff(attempt)
+		if remaining, ok := Remaining(ctx); ok && remaining <= backoff {
+			actx.Warn("attempt failed, deadline is too close to retry", "err", err, "remaining", remaining)
+			return err
+		}
+		actx.Warn("attempt failed, will retry", "err", err, "backoff", backoff)
+
+		var timer = time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package xiao
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/cjey/xiao/gerror"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/typepb"
+)
+
+func TestRetry(t *testing.T) {
+	var ctx = NamedContext("TestRetry")
+	var policy = RetryPolicy{InitialBackoff: time.Millisecond, MaxAttempts: 5}
+
+	var names []string
+	var err = Retry(ctx, policy, func(ctx Context) error {
+		names = append(names, ctx.Name()+"@"+ctx.Location())
+		if len(names) < 3 {
+			return status.Error(codes.Unavailable, "down")
+		}
+		return nil
+	})
+	if err != nil || len(names) != 3 || names[0] != "TestRetry.1@retry-1" || names[2] != "TestRetry.3@retry-3" {
+		t.Errorf("unexpected attempts: %v, %v", names, err)
+	}
+
+	var count = func(policy RetryPolicy, e error) (int, error) {
+		var n int
+		var err = Retry(ctx, policy, func(Context) error {
+			n++
+			return e
+		})
+		return n, err
+	}
+	var business = gerror.New(typepb.Field_TYPE_STRING, "bad")
+	var global = &gerror.GError{Code: gerror.CODE_GLOBAL_BOUNDARY + 1, Name: "QUOTA_EXCEEDED"}
+	for _, c := range []struct {
+		policy RetryPolicy
+		err    error
+		expect int
+	}{
+		{policy, business, 1},
+		{policy, business.Encode(), 1},
+		{RetryPolicy{InitialBackoff: time.Millisecond, RetryBusiness: true}, business.Encode(), 3},
+		{RetryPolicy{InitialBackoff: time.Millisecond, RetryBusiness: true}, global.Encode(), 1},
+		{policy, status.Error(codes.InvalidArgument, "bad"), 1},
+		{policy, errors.New("plain"), 1},
+		{policy, status.Error(codes.ResourceExhausted, "busy"), 5},
+		{policy, status.Error(codes.DeadlineExceeded, "slow"), 5},
+		{RetryPolicy{InitialBackoff: time.Millisecond, Retryable: func(error) bool { return true }}, errors.New("plain"), 3},
+	} {
+		if n, err := count(c.policy, c.err); n != c.expect || err != c.err {
+			t.Errorf("%v: expect %d attempts, got %d, %v", c.err, c.expect, n, err)
+		}
+	}
+
+	// attempt timeout is retryable
+	var n int
+	err = Retry(ctx, RetryPolicy{InitialBackoff: time.Millisecond, AttemptTimeout: time.Millisecond}, func(ctx Context) error {
+		n++
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	if n != 3 || !errors.Is(err, DeadlineExceeded) {
+		t.Errorf("unexpected attempt timeout result: %d, %v", n, err)
+	}
+
+	// stop on parent deadline
+	var dctx, cancel = ctx.WithTimeout(200 * time.Millisecond)
+	defer cancel()
+	n = 0
+	err = Retry(dctx, RetryPolicy{InitialBackoff: 150 * time.Millisecond, MaxAttempts: 10, Jitter: -1}, func(Context) error {
+		n++
+		return status.Error(codes.Unavailable, "down")
+	})
+	if n != 2 || status.Code(err) != codes.Unavailable {
+		t.Errorf("retry should stop before deadline: %d, %v", n, err)
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	var p = RetryPolicy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second, Jitter: -1}.withDefaults()
+	for n, expect := range []time.Duration{100, 200, 400, 800, 1000, 1000} {
+		if d := p.backoff(n + 1); d != expect*time.Millisecond {
+			t.Errorf("backoff %d: expect %s, got %s", n+1, expect*time.Millisecond, d)
+		}
+	}
+	p.Jitter = 0.5
+	for range 100 {
+		if d := p.backoff(1); d < 50*time.Millisecond || d > 150*time.Millisecond {
+			t.Fatalf("unexpected jitter: %s", d)
+		}
+	}
+}
@@ -0,0 +1,319 @@
+package xiao
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// SamplingConfig 定义了日志的采样和限速规则。
+// 采样以 等级+消息+'@'位置 作为key，每个统计周期内，同一key的前First条日志全部输出，
+// 此后每Thereafter条输出1条；限速则以logger的名称为key，使用令牌桶算法。
+// 被抑制的日志条数会以一条Warn汇总日志的形式输出：该key在下一个周期再次输出日志时立即输出，
+// 否则由后台按周期输出，因此突发之后不再出现的日志也不会丢失汇总。
+// Panic和Fatal等级的日志永远不会被抑制。
+type SamplingConfig struct {
+	// Interval 采样的统计周期，默认1秒
+	Interval time.Duration
+	// First 每个周期内同一key全部输出的条数，0表示不做采样
+	First int
+	// Thereafter 超过First之后，每Thereafter条输出1条，0表示全部丢弃
+	Thereafter int
+
+	// RateLimits 按名称进行限速，key为logger名称，同时会匹配其所有的Fork，
+	// 例如key为"ZookeeperMonitor"时，会匹配"ZookeeperMonitor"和"ZookeeperMonitor.1"，
+	// 有多个key匹配时，使用最长的那个，空字符串则可以匹配所有名称
+	RateLimits map[string]RateLimit
+}
+
+// RateLimit 定义了一个令牌桶
+type RateLimit struct {
+	Rate  float64 // 每秒生成的令牌数
+	Burst int     // 桶的容量
+}
+
+// WithSampling 为NewSimpleLogger开启采样和限速
+func WithSampling(cfg SamplingConfig) SimpleOption {
+	return func(o *simpleOptions) {
+		var s = newSampler(cfg)
+		o.wrappers = append(o.wrappers, func(core zapcore.Core) zapcore.Core {
+			return &samplingCore{Core: core, s: s}
+		})
+	}
+}
+
+// NewSamplingCore 返回一个按照给定规则执行采样和限速的zapcore.Core，
+// 用于自行构建zap.Logger的场景
+func NewSamplingCore(core zapcore.Core, cfg SamplingConfig) zapcore.Core {
+	return &samplingCore{Core: core, s: newSampler(cfg)}
+}
+
+// 超过此数量的采样key时，会清空所有计数，避免动态消息导致内存无限增长
+const _MAX_SAMPLING_KEYS = 4096
+
+type sampleCounter struct {
+	resetAt    time.Time
+	n          uint64
+	suppressed uint64
+	// the core and entry of the last suppressed message, used by the periodic summary
+	core zapcore.Core
+	ent  zapcore.Entry
+}
+
+type tokenBucket struct {
+	limit      RateLimit
+	tokens     float64
+	last       time.Time
+	suppressed uint64
+	core       zapcore.Core
+	ent        zapcore.Entry
+}
+
+// pendingSummary 是一条待输出的汇总日志
+type pendingSummary struct {
+	core       zapcore.Core
+	ent        zapcore.Entry
+	suppressed uint64
+	field      zapcore.Field
+}
+
+func (c *sampleCounter) pending() pendingSummary {
+	return pendingSummary{core: c.core, ent: c.ent, suppressed: c.suppressed, field: zap.String("sampled", c.ent.Message)}
+}
+
+func (p pendingSummary) write(now time.Time) {
+	writeSummary(p.core, p.ent, now, p.suppressed, p.field)
+}
+
+type sampler struct {
+	interval   time.Duration
+	first      uint64
+	thereafter uint64
+
+	mu       sync.Mutex
+	counters map[string]*sampleCounter
+	buckets  map[string]*tokenBucket
+	flushing bool
+}
+
+func newSampler(cfg SamplingConfig) *sampler {
+	var s = &sampler{
+		interval:   cfg.Interval,
+		counters:   make(map[string]*sampleCounter),
+		buckets:    make(map[string]*tokenBucket),
+		thereafter: uint64(max(cfg.Thereafter, 0)),
+		first:      uint64(max(cfg.First, 0)),
+	}
+	if s.interval <= 0 {
+		s.interval = time.Second
+	}
+	for name, limit := range cfg.RateLimits {
+		if limit.Burst < 1 {
+			limit.Burst = 1
+		}
+		s.buckets[name] = &tokenBucket{limit: limit, tokens: float64(limit.Burst)}
+	}
+	return s
+}
+
+// sample 返回本条日志是否应当输出，以及上个周期内被抑制的条数，
+// evicted是因为key过多被清空时尚未输出的汇总
+func (s *sampler) sample(key string, core zapcore.Core, ent zapcore.Entry) (ok bool, suppressed uint64, evicted []pendingSummary) {
+	if s.first == 0 {
+		return true, 0, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var now = ent.Time
+	var c = s.counters[key]
+	if c == nil {
+		if len(s.counters) >= _MAX_SAMPLING_KEYS {
+			for _, c := range s.counters {
+				if c.suppressed > 0 {
+					evicted = append(evicted, c.pending())
+				}
+			}
+			clear(s.counters)
+		}
+		c = &sampleCounter{resetAt: now.Add(s.interval)}
+		s.counters[key] = c
+	}
+
+	if !now.Before(c.resetAt) {
+		suppressed, c.suppressed = c.suppressed, 0
+		c.n = 0
+		c.resetAt = now.Add(s.interval)
+	}
+
+	c.n++
+	if c.n <= s.first || (s.thereafter > 0 && (c.n-s.first)%s.thereafter == 0) {
+		return true, suppressed, evicted
+	}
+	c.suppressed++
+	c.core, c.ent = core, ent
+	s.schedule()
+	return false, 0, evicted
+}
+
+// schedule 启动后台汇总，需要持有锁
+func (s *sampler) schedule() {
+	if !s.flushing {
+		s.flushing = true
+		go s.flushLoop()
+	}
+}
+
+// flushLoop 每个周期输出一次汇总，直到没有被抑制的日志为止
+func (s *sampler) flushLoop() {
+	var ticker = time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		if !s.flush(now) {
+			return
+		}
+	}
+}
+
+// flush 输出所有周期已经结束的采样汇总和所有限速汇总，返回是否还有未输出的汇总
+func (s *sampler) flush(now time.Time) (more bool) {
+	var sums []pendingSummary
+	s.mu.Lock()
+	for _, c := range s.counters {
+		if c.suppressed == 0 {
+			continue
+		}
+		if now.Before(c.resetAt) {
+			more = true
+			continue
+		}
+		sums = append(sums, c.pending())
+		c.suppressed, c.n = 0, 0
+		c.resetAt = now.Add(s.interval)
+	}
+	for key, b := range s.buckets {
+		if b.suppressed > 0 {
+			sums = append(sums, pendingSummary{core: b.core, ent: b.ent, suppressed: b.suppressed, field: zap.String("limited", key)})
+			b.suppressed = 0
+		}
+	}
+	if !more {
+		s.flushing = false
+	}
+	s.mu.Unlock()
+
+	for _, sum := range sums {
+		sum.write(now)
+	}
+	return more
+}
+
+// limit 返回本条日志是否应当输出，以及此前被限速抑制的条数
+func (s *sampler) limit(core zapcore.Core, ent zapcore.Entry) (bool, string, uint64) {
+	var name, now = ent.LoggerName, ent.Time
+	if len(s.buckets) == 0 {
+		return true, "", 0
+	}
+
+	var key, found = "", false
+	for k := range s.buckets {
+		if k == "" || name == k || strings.HasPrefix(name, k+".") {
+			if !found || len(k) > len(key) {
+				key, found = k, true
+			}
+		}
+	}
+	if !found {
+		return true, "", 0
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var b = s.buckets[key]
+	if !b.last.IsZero() {
+		b.tokens += now.Sub(b.last).Seconds() * b.limit.Rate
+		if burst := float64(b.limit.Burst); b.tokens > burst {
+			b.tokens = burst
+		}
+	}
+	b.last = now
+
+	if b.tokens < 1 {
+		b.suppressed++
+		b.core, b.ent = core, ent
+		s.schedule()
+		return false, key, 0
+	}
+	b.tokens--
+	var suppressed = b.suppressed
+	b.suppressed = 0
+	return true, key, suppressed
+}
+
+// samplingCore 记录下当前的位置信息，从而可以按照 消息+'@'位置 进行采样
+type samplingCore struct {
+	zapcore.Core
+	s        *sampler
+	location string
+}
+
+func (c *samplingCore) With(fields []zapcore.Field) zapcore.Core {
+	var location = c.location
+	for _, f := range fields {
+		if f.Key == locationKey && f.Type == zapcore.StringType {
+			location = f.String
+		}
+	}
+	return &samplingCore{Core: c.Core.With(fields), s: c.s, location: location}
+}
+
+func (c *samplingCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if !c.Core.Enabled(ent.Level) {
+		return ce
+	}
+	if ent.Level >= zapcore.DPanicLevel {
+		return c.Core.Check(ent, ce)
+	}
+
+	var key = ent.Level.String() + "|" + ent.Message + locationKey + c.location
+	var ok, suppressed, evicted = c.s.sample(key, c.Core, ent)
+	for _, sum := range evicted {
+		sum.write(ent.Time)
+	}
+	if !ok {
+		return ce
+	}
+	if suppressed > 0 {
+		writeSummary(c.Core, ent, ent.Time, suppressed, zap.String("sampled", ent.Message))
+	}
+
+	var limited string
+	ok, limited, suppressed = c.s.limit(c.Core, ent)
+	if !ok {
+		return ce
+	}
+	if suppressed > 0 {
+		writeSummary(c.Core, ent, ent.Time, suppressed, zap.String("limited", limited))
+	}
+
+	return c.Core.Check(ent, ce)
+}
+
+// writeSummary 以ent的名称输出一条Warn汇总日志
+func writeSummary(core zapcore.Core, ent zapcore.Entry, now time.Time, suppressed uint64, fields ...zapcore.Field) {
+	var sum = zapcore.Entry{
+		Level:      zapcore.WarnLevel,
+		Time:       now,
+		LoggerName: ent.LoggerName,
+		Message:    "suppressed " + strconv.FormatUint(suppressed, 10) + " similar messages",
+	}
+	if ce := core.Check(sum, nil); ce != nil {
+		ce.Write(fields...)
+	}
+}
@@ -0,0 +1,160 @@
+package xiao
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestSampling(t *testing.T) {
+	var core, logs = observer.New(zapcore.DebugLevel)
+	defer ReplaceLogger(zap.New(NewSamplingCore(core, SamplingConfig{
+		Interval:   50 * time.Millisecond,
+		First:      2,
+		Thereafter: 3,
+	})))()
+
+	var ctx = NamedContext("TestSampling").At("loop")
+	for i := 0; i < 10; i++ {
+		ctx.Warn("hot")
+	}
+	// 1, 2, 5, 8
+	if n := logs.Len(); n != 4 {
+		t.Fatalf("expect 4 entries, got %d", n)
+	}
+	ctx.At("other").Warn("hot")
+	if n := logs.Len(); n != 5 {
+		t.Fatalf("different location should be sampled separately, got %d", n)
+	}
+	logs.TakeAll()
+
+	time.Sleep(60 * time.Millisecond)
+	ctx.Warn("hot")
+	var got = logs.TakeAll()
+	if len(got) != 2 || got[0].Message != "suppressed 6 similar messages" || got[1].Message != "hot" {
+		t.Fatalf("expect summary line, got %v", got)
+	}
+}
+
+// manualClock is a zapcore.Clock advanced by hand, so tests do not depend on the wall clock
+type manualClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *manualClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *manualClock) Add(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func (c *manualClock) NewTicker(d time.Duration) *time.Ticker {
+	return time.NewTicker(d)
+}
+
+func TestRateLimit(t *testing.T) {
+	var clock = &manualClock{now: time.Now()}
+	var core, logs = observer.New(zapcore.DebugLevel)
+	defer ReplaceLogger(zap.New(NewSamplingCore(core, SamplingConfig{
+		// no periodic summary during the test
+		Interval: time.Hour,
+		RateLimits: map[string]RateLimit{
+			"limited": {Rate: 1000, Burst: 2},
+		},
+	}), zap.WithClock(clock)))()
+
+	var ctx = NamedContext("limited").Fork()
+	for i := 0; i < 5; i++ {
+		ctx.Info("hot", "i", i)
+	}
+	if n := logs.Len(); n != 2 {
+		t.Fatalf("expect 2 entries, got %d", n)
+	}
+	NamedContext("free").Info("free")
+	if n := logs.Len(); n != 3 {
+		t.Fatalf("other names should not be limited, got %d", n)
+	}
+	logs.TakeAll()
+
+	clock.Add(10 * time.Millisecond)
+	ctx.Info("hot")
+	var got = logs.TakeAll()
+	if len(got) != 2 || got[0].Message != "suppressed 3 similar messages" {
+		t.Fatalf("expect summary line, got %v", got)
+	}
+}
+
+func TestSamplingPeriodicSummary(t *testing.T) {
+	var core, logs = observer.New(zapcore.DebugLevel)
+	defer ReplaceLogger(zap.New(NewSamplingCore(core, SamplingConfig{
+		Interval: 20 * time.Millisecond,
+		First:    1,
+		RateLimits: map[string]RateLimit{
+			"limited": {Rate: 0.001, Burst: 1},
+		},
+	})))()
+
+	// a burst that stops should still report its suppressed count
+	var ctx = NamedContext("TestSamplingPeriodicSummary")
+	for i := 0; i < 5; i++ {
+		ctx.Warn("burst")
+	}
+	var limited = NamedContext("limited")
+	limited.Info("first")
+	limited.Info("second")
+	var deadline = time.Now().Add(time.Second)
+	for logs.FilterMessage("suppressed 4 similar messages").FilterField(zap.String("sampled", "burst")).Len() != 1 ||
+		logs.FilterMessage("suppressed 1 similar messages").FilterField(zap.String("limited", "limited")).Len() != 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("expect periodic summaries, got %v", logs.All())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestSamplingEvictionSummary(t *testing.T) {
+	var core, logs = observer.New(zapcore.DebugLevel)
+	defer ReplaceLogger(zap.New(NewSamplingCore(core, SamplingConfig{
+		Interval: time.Hour,
+		First:    1,
+	})))()
+
+	var ctx = NamedContext("TestSamplingEvictionSummary")
+	ctx.Info("a")
+	ctx.Info("a")
+	for i := 0; i < _MAX_SAMPLING_KEYS; i++ {
+		ctx.Info(strconv.Itoa(i))
+	}
+	if logs.FilterMessage("suppressed 1 similar messages").FilterField(zap.String("sampled", "a")).Len() != 1 {
+		t.Errorf("pending count should be reported before clearing")
+	}
+}
+
+func TestSamplingWithLevel(t *testing.T) {
+	var core, logs = observer.New(zapcore.InfoLevel)
+	defer ReplaceLogger(zap.New(NewSamplingCore(core, SamplingConfig{
+		Interval: time.Hour,
+		First:    1,
+	})))()
+
+	// entries enabled by WithLevel are still sampled
+	var ctx = NamedContext("TestSamplingWithLevel").WithLevel(DebugLevel)
+	for i := 0; i < 5; i++ {
+		ctx.Debug("hot")
+	}
+	var got = logs.TakeAll()
+	if len(got) != 1 || got[0].Level != DebugLevel {
+		t.Fatalf("expect 1 debug entry, got %v", got)
+	}
+}
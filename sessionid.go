@@ -0,0 +1,229 @@
+package xiao
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cjey/xiao/netkit"
+	"github.com/google/uuid"
+)
+
+// SessionIDScheme 定义了SessionalContext名称的生成规则
+type SessionIDScheme interface {
+	// NewID 返回一个新的session id，必须是并发安全的
+	NewID() string
+}
+
+// SessionIDSchemeFunc 将一个函数适配为SessionIDScheme
+type SessionIDSchemeFunc func() string
+
+func (f SessionIDSchemeFunc) NewID() string {
+	return f()
+}
+
+// 默认使用基于BootID的命名规则，参见SessionNameGenerator
+var _sessionScheme atomic.Pointer[SessionIDScheme]
+
+// UseSessionIDScheme 设置SessionalContext使用的命名规则，nil表示恢复为默认的基于BootID的规则，
+// 返回的函数用于恢复之前的设置
+func UseSessionIDScheme(scheme SessionIDScheme) func() {
+	var prev *SessionIDScheme
+	if scheme == nil {
+		prev = _sessionScheme.Swap(nil)
+	} else {
+		prev = _sessionScheme.Swap(&scheme)
+	}
+	return func() {
+		if prev == nil {
+			UseSessionIDScheme(nil)
+		} else {
+			UseSessionIDScheme(*prev)
+		}
+	}
+}
+
+// newSessionName 使用当前的命名规则生成session名称，prefix会被附加在最前面
+func newSessionName(prefix ...string) string {
+	var scheme = _sessionScheme.Load()
+	if scheme == nil {
+		return bootQ(prefix...)
+	}
+	if len(prefix) > 0 {
+		return prefix[0] + (*scheme).NewID()
+	}
+	return (*scheme).NewID()
+}
+
+// BootSessionID 是默认命名规则生成的session名称的组成部分
+type BootSessionID struct {
+	// Prefix 是生成时指定的前缀
+	Prefix string
+	// Boot 是BootID的前24位，可以用于确定是哪一次启动的进程生成的
+	Boot string
+	// Seq 是进程内的自增序号
+	Seq uint64
+}
+
+// CurrentBoot 表示是否由当前进程生成
+func (id BootSessionID) CurrentBoot() bool {
+	return strings.HasPrefix(BootID, id.Boot)
+}
+
+// ParseBootSessionID 解析默认命名规则生成的session名称，可以包含Fork产生的后缀，
+// 例如"9b2119d3-7f37-4033-8c19-000000000001.1.2"
+func ParseBootSessionID(name string) (BootSessionID, error) {
+	var id BootSessionID
+	if i := strings.IndexByte(name, '.'); i >= 0 {
+		name = name[:i]
+	}
+	// sequence digits, at least 12
+	var k = len(name)
+	for k > 0 && name[k-1] >= '0' && name[k-1] <= '9' {
+		k--
+	}
+	if len(name)-k < 12 || k < 24 {
+		return id, errors.New("invalid boot session id")
+	}
+	var boot = name[k-24 : k]
+	if _, err := uuid.Parse(boot + "000000000000"); err != nil {
+		return id, errors.New("invalid boot session id")
+	}
+	var seq, err = strconv.ParseUint(name[k:], 10, 64)
+	if err != nil {
+		return id, fmt.Errorf("invalid boot session id: %w", err)
+	}
+	id.Prefix, id.Boot, id.Seq = name[:k-24], boot, seq
+	return id, nil
+}
+
+// UUIDv7Scheme 返回使用UUIDv7作为session名称的规则，按时间有序
+func UUIDv7Scheme() SessionIDScheme {
+	return SessionIDSchemeFunc(func() string {
+		var u, err = uuid.NewV7()
+		if err != nil {
+			return uuid.NewString()
+		}
+		return u.String()
+	})
+}
+
+// ULIDScheme 返回使用ULID作为session名称的规则，按时间有序，同一毫秒内单调递增
+func ULIDScheme() SessionIDScheme {
+	return &ulidScheme{}
+}
+
+const _CROCKFORD_BASE32 = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+type ulidScheme struct {
+	mu      sync.Mutex
+	lastMS  uint64
+	entropy [10]byte
+}
+
+func (s *ulidScheme) NewID() string {
+	var ms = uint64(time.Now().UnixMilli())
+
+	s.mu.Lock()
+	if ms > s.lastMS {
+		s.lastMS = ms
+		var hi, lo = rand.Uint64(), rand.Uint64()
+		for i := range 8 {
+			s.entropy[i] = byte(hi >> (56 - 8*i))
+		}
+		s.entropy[8], s.entropy[9] = byte(lo>>8), byte(lo)
+	} else {
+		// same millisecond or clock moved backwards, increase entropy
+		ms = s.lastMS
+		for i := len(s.entropy) - 1; i >= 0; i-- {
+			s.entropy[i]++
+			if s.entropy[i] != 0 {
+				break
+			}
+		}
+	}
+	var b [16]byte
+	for i := range 6 {
+		b[i] = byte(ms >> (40 - 8*i))
+	}
+	copy(b[6:], s.entropy[:])
+	s.mu.Unlock()
+
+	return encodeULID(b)
+}
+
+// encodeULID 将128位按Crockford base32编码为26个字符，首字符只使用3位
+func encodeULID(b [16]byte) string {
+	var out [26]byte
+	var hi = uint64(b[0])<<56 | uint64(b[1])<<48 | uint64(b[2])<<40 | uint64(b[3])<<32 |
+		uint64(b[4])<<24 | uint64(b[5])<<16 | uint64(b[6])<<8 | uint64(b[7])
+	var lo = uint64(b[8])<<56 | uint64(b[9])<<48 | uint64(b[10])<<40 | uint64(b[11])<<32 |
+		uint64(b[12])<<24 | uint64(b[13])<<16 | uint64(b[14])<<8 | uint64(b[15])
+	for i := 25; i >= 0; i-- {
+		out[i] = _CROCKFORD_BASE32[lo&0x1f]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(out[:])
+}
+
+// SnowflakeEpoch 是Snowflake规则的起始时间
+var SnowflakeEpoch = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+const (
+	_SNOWFLAKE_WORKER_BITS = 10
+	_SNOWFLAKE_SEQ_BITS    = 12
+	_SNOWFLAKE_MAX_WORKER  = 1<<_SNOWFLAKE_WORKER_BITS - 1
+	_SNOWFLAKE_MAX_SEQ     = 1<<_SNOWFLAKE_SEQ_BITS - 1
+)
+
+// SnowflakeScheme 返回使用Snowflake算法的规则，生成十进制的64位整数，
+// 由41位毫秒时间戳、10位worker id和12位序号组成。
+// worker < 0 时使用MyManIP的低10位作为worker id。
+func SnowflakeScheme(worker int64) (SessionIDScheme, error) {
+	if worker < 0 {
+		var ip = netkit.MyManIP().To4()
+		if ip == nil {
+			return nil, errors.New("snowflake: no ipv4 address for worker id")
+		}
+		worker = (int64(ip[2])<<8 | int64(ip[3])) & _SNOWFLAKE_MAX_WORKER
+	}
+	if worker > _SNOWFLAKE_MAX_WORKER {
+		return nil, fmt.Errorf("snowflake: worker id must be in [0, %d]", _SNOWFLAKE_MAX_WORKER)
+	}
+	return &snowflakeScheme{worker: worker}, nil
+}
+
+type snowflakeScheme struct {
+	mu     sync.Mutex
+	worker int64
+	lastMS int64
+	seq    int64
+}
+
+func (s *snowflakeScheme) NewID() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var ms = time.Since(SnowflakeEpoch).Milliseconds()
+	if ms < s.lastMS {
+		// clock moved backwards, keep using the last one
+		ms = s.lastMS
+	}
+	if ms == s.lastMS {
+		s.seq = (s.seq + 1) & _SNOWFLAKE_MAX_SEQ
+		if s.seq == 0 {
+			// sequence exhausted, borrow the next millisecond
+			ms++
+		}
+	} else {
+		s.seq = 0
+	}
+	s.lastMS = ms
+	var id = ms<<(_SNOWFLAKE_WORKER_BITS+_SNOWFLAKE_SEQ_BITS) | s.worker<<_SNOWFLAKE_SEQ_BITS | s.seq
+	return strconv.FormatInt(id, 10)
+}
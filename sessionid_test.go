@@ -0,0 +1,83 @@
+package xiao
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestParseBootSessionID(t *testing.T) {
+	var ctx = SessionalContext("req-")
+	var id, err = ParseBootSessionID(ctx.Fork().Fork().Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id.Prefix != "req-" || id.Boot != BootID[:24] || id.Seq == 0 || !id.CurrentBoot() {
+		t.Errorf("unexpected parsed id: %+v", id)
+	}
+
+	// beyond 12 digits
+	id, err = ParseBootSessionID("9b2119d3-7f37-4033-8c19-1000000000000")
+	if err != nil || id.Seq != 1000000000000 || id.Prefix != "" || id.CurrentBoot() {
+		t.Errorf("unexpected parsed id: %+v, %v", id, err)
+	}
+	for _, bad := range []string{"", "TestSession", "9b2119d3-7f37-4033-8c19-00000001", "9b2119d3-7f37-4033-8c1x-000000000001"} {
+		if _, err := ParseBootSessionID(bad); err == nil {
+			t.Errorf("expect error for %q", bad)
+		}
+	}
+}
+
+func TestSessionIDSchemes(t *testing.T) {
+	var restore = UseSessionIDScheme(UUIDv7Scheme())
+	var name = SessionalContext("p-").Name()
+	restore()
+	if u, err := uuid.Parse(strings.TrimPrefix(name, "p-")); err != nil || u.Version() != 7 {
+		t.Errorf("unexpected uuidv7 session: %s", name)
+	}
+	if _, err := ParseBootSessionID(SessionalContext().Name()); err != nil {
+		t.Errorf("default scheme should be restored: %v", err)
+	}
+
+	if s := encodeULID([16]byte{}); s != "00000000000000000000000000" {
+		t.Errorf("unexpected zero ulid: %s", s)
+	}
+	var max [16]byte
+	for i := range max {
+		max[i] = 0xff
+	}
+	if s := encodeULID(max); s != "7ZZZZZZZZZZZZZZZZZZZZZZZZZ" {
+		t.Errorf("unexpected max ulid: %s", s)
+	}
+
+	var ulid = ULIDScheme()
+	var snowflake, err = SnowflakeScheme(5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lastULID, lastSnowflake string
+	var lastNum int64
+	for range 10000 {
+		var u = ulid.NewID()
+		if len(u) != 26 || u <= lastULID {
+			t.Fatalf("ulid should be monotonic: %s <= %s", u, lastULID)
+		}
+		lastULID = u
+
+		var s = snowflake.NewID()
+		var n, _ = strconv.ParseInt(s, 10, 64)
+		if n <= lastNum || (n>>12)&1023 != 5 {
+			t.Fatalf("unexpected snowflake: %s after %s", s, lastSnowflake)
+		}
+		lastSnowflake, lastNum = s, n
+	}
+
+	if _, err := SnowflakeScheme(1024); err == nil {
+		t.Errorf("expect error for worker out of range")
+	}
+	if _, err := SnowflakeScheme(-1); err != nil {
+		t.Errorf("worker should be derived from ip: %v", err)
+	}
+}
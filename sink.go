@@ -0,0 +1,428 @@
+package xiao
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// SinkConfig 定义了一个日志输出目标，每个目标都有独立的日志等级和编码方式，
+// 但都使用默认风格的M/L/T/N/C字段布局，并且都会带上'@'位置字段
+type SinkConfig struct {
+	// Level 日志等级，与NewSimpleLogger的level参数相同
+	Level string
+	// Path 输出路径，支持stderr、stdout、文件路径，以及syslog和journald，详见syslog.go
+	Path string
+	// Encoding 编码方式，例如console、json、logfmt、color-console
+	Encoding string
+	// Rotation 文件轮转配置，仅对文件路径有效，nil表示不轮转
+	Rotation *Rotation
+}
+
+// Rotation 定义了按大小执行的日志文件轮转，
+// 当文件大小超过MaxSize时，当前文件会被重命名为path.1，原有的path.1重命名为path.2，以此类推
+type Rotation struct {
+	// MaxSize 单个文件的最大字节数
+	MaxSize int64
+	// MaxBackups 保留的历史文件数量，0表示不保留
+	MaxBackups int
+}
+
+// UseSinkLogger 使用多目标输出的默认风格logger替换掉全局的zap.Logger，
+// 返回的函数在恢复原有logger的同时会关闭新logger，参见CloseLogger
+func UseSinkLogger(sinks []SinkConfig, disableCaller bool, opts ...SimpleOption) (func(), error) {
+	var logger, err = NewSinkLogger(sinks, disableCaller, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return useLogger(logger), nil
+}
+
+// NewSinkLogger 生成并返回一个同时输出到多个目标的默认风格的zap.Logger，
+// 例如同时输出debug等级的console日志到终端，和info等级的json日志到文件
+func NewSinkLogger(sinks []SinkConfig, disableCaller bool, opts ...SimpleOption) (*zap.Logger, error) {
+	if len(sinks) == 0 {
+		return nil, errors.New("no sink given")
+	}
+
+	var sopts simpleOptions
+	for _, opt := range opts {
+		opt(&sopts)
+	}
+
+	var loggers = make([]*zap.Logger, 0, len(sinks))
+	var closers = make([]func() error, 0, len(sinks))
+	for _, sink := range sinks {
+		var logger, closer, err = newSinkLogger(sink, disableCaller, &sopts)
+		if err != nil {
+			// close the sinks already opened
+			for _, closer := range closers {
+				closer()
+			}
+			return nil, err
+		}
+		loggers = append(loggers, logger)
+		closers = append(closers, closer)
+	}
+
+	var logger = loggers[0]
+	if len(loggers) > 1 {
+		var tee = make(sinkTee, 0, len(loggers))
+		for _, l := range loggers {
+			tee = append(tee, l.Core())
+		}
+		logger = logger.WithOptions(zap.WrapCore(func(zapcore.Core) zapcore.Core {
+			return tee
+		}))
+	}
+	logger = logger.WithOptions(sopts.zapOptions()...)
+	registerCloser(logger, closers)
+	return logger, nil
+}
+
+// newSinkLogger 返回一个只输出到sink的zap.Logger，以及关闭其输出的函数
+func newSinkLogger(sink SinkConfig, disableCaller bool, sopts *simpleOptions) (_ *zap.Logger, closer func() error, _ error) {
+	var zlevel, err = ParseLevel(sink.Level)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var zcfg = zap.Config{
+		Level:             zap.NewAtomicLevelAt(zlevel),
+		Development:       false,
+		DisableCaller:     disableCaller,
+		DisableStacktrace: true,
+		Sampling:          nil,
+		Encoding:          "console",
+
+		EncoderConfig: simpleEncoderConfig(),
+
+		OutputPaths:      nil, // the core is built by myself
+		ErrorOutputPaths: nil, // only zap internal error
+		InitialFields:    nil,
+	}
+
+	var core zapcore.Core
+	if u, ok := parseRecordSink(sink.Path); ok {
+		var rcore *recordCore
+		if rcore, err = newRecordCore(u, zcfg.Level); err != nil {
+			return nil, nil, err
+		}
+		core, closer = rcore, rcore.Close
+	} else if core, closer, err = newOutputCore(sink, zcfg.Level, zcfg.EncoderConfig, sopts); err != nil {
+		return nil, nil, err
+	}
+
+	logger, err := zcfg.Build(zap.WrapCore(func(zapcore.Core) zapcore.Core {
+		return core
+	}))
+	if err != nil {
+		closer()
+		return nil, nil, err
+	}
+	return logger, closer, nil
+}
+
+// newOutputCore 返回输出到文件、stderr或stdout的core，以及关闭输出的函数
+func newOutputCore(sink SinkConfig, enab zap.AtomicLevel, ecfg zapcore.EncoderConfig, sopts *simpleOptions) (zapcore.Core, func() error, error) {
+	if dir := filepath.Dir(sink.Path); dir != "." && dir != ".." && dir != "/" {
+		if _, e := os.Stat(dir); errors.Is(e, os.ErrNotExist) {
+			if e := os.MkdirAll(dir, 0755); e != nil {
+				return nil, nil, e
+			}
+		}
+	}
+
+	var outpath = sink.Path
+	if sink.Rotation != nil && outpath != "stderr" && outpath != "stdout" {
+		var err error
+		if outpath, err = rotateURL(sink.Path, sink.Rotation); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	var encoding = sink.Encoding
+	if encoding == EncodingColorConsole && !isTerminal(sink.Path) {
+		encoding = "console"
+	}
+	if sopts.async == nil {
+		var out, closeOut, err = zap.Open(outpath)
+		if err != nil {
+			return nil, nil, err
+		}
+		core, err := newSyncCore(encoding, ecfg, out, enab)
+		if err != nil {
+			closeOut()
+			return nil, nil, err
+		}
+		return core, func() error {
+			closeOut()
+			return nil
+		}, nil
+	}
+
+	enc, err := newEncoder(encoding, ecfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	out, closeOut, err := zap.Open(outpath)
+	if err != nil {
+		return nil, nil, err
+	}
+	var core = newAsyncCore(enc, out, closeOut, enab, *sopts.async)
+	return core, core.Close, nil
+}
+
+// newSyncCore 返回同步写入out的core，
+// 除内置的编码方式之外，也支持通过zap.RegisterEncoder注册的编码方式
+func newSyncCore(encoding string, ecfg zapcore.EncoderConfig, out zapcore.WriteSyncer, enab zap.AtomicLevel) (zapcore.Core, error) {
+	if enc, err := newEncoder(encoding, ecfg); err == nil {
+		return zapcore.NewCore(enc, out, enab), nil
+	}
+
+	// zap does not export its encoder registry, build through zap.Config with out as the output
+	var id = strconv.FormatUint(_writerSeq.Add(1), 10)
+	_writers.Store(id, out)
+	defer _writers.Delete(id)
+	var zcfg = zap.Config{
+		Level:         enab,
+		Encoding:      encoding,
+		EncoderConfig: ecfg,
+		OutputPaths:   []string{_WRITER_SCHEME + "://" + id},
+	}
+	var logger, err = zcfg.Build()
+	if err != nil {
+		return nil, err
+	}
+	return logger.Core(), nil
+}
+
+// sinkTee 与zapcore.NewTee相同，但直接调用Write时，只会写入启用了该等级的目标，
+// 如果没有任何目标启用了该等级，例如飞行记录模式下缓存的debug日志，则写入日志等级最低的那些目标
+type sinkTee []zapcore.Core
+
+func (t sinkTee) Enabled(lvl zapcore.Level) bool {
+	for _, c := range t {
+		if c.Enabled(lvl) {
+			return true
+		}
+	}
+	return false
+}
+
+func (t sinkTee) With(fields []zapcore.Field) zapcore.Core {
+	var t2 = make(sinkTee, len(t))
+	for i := range t {
+		t2[i] = t[i].With(fields)
+	}
+	return t2
+}
+
+func (t sinkTee) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	for _, c := range t {
+		ce = c.Check(ent, ce)
+	}
+	return ce
+}
+
+func (t sinkTee) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	var errs []error
+	var written bool
+	for _, c := range t {
+		if c.Enabled(ent.Level) {
+			errs = append(errs, c.Write(ent, fields))
+			written = true
+		}
+	}
+	if written {
+		return errors.Join(errs...)
+	}
+
+	var lowest = zapcore.InvalidLevel
+	for _, c := range t {
+		if lvl := zapcore.LevelOf(c); lowest == zapcore.InvalidLevel || lvl < lowest {
+			lowest = lvl
+		}
+	}
+	for _, c := range t {
+		if zapcore.LevelOf(c) == lowest {
+			errs = append(errs, c.Write(ent, fields))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (t sinkTee) Sync() error {
+	var errs []error
+	for _, c := range t {
+		errs = append(errs, c.Sync())
+	}
+	return errors.Join(errs...)
+}
+
+const (
+	_ROTATE_SCHEME = "xiao-rotate"
+	_WRITER_SCHEME = "xiao-writer"
+)
+
+func init() {
+	if err := zap.RegisterSink(_ROTATE_SCHEME, newRotateSink); err != nil {
+		panic(err)
+	}
+	if err := zap.RegisterSink(_WRITER_SCHEME, newWriterSink); err != nil {
+		panic(err)
+	}
+}
+
+// 以下用于将已经打开的输出交给zap.Config.Build，参见newSyncCore
+var (
+	_writerSeq atomic.Uint64
+	_writers   sync.Map // id => zapcore.WriteSyncer
+)
+
+// writerSink 包装已经打开的输出，Close什么也不做，输出由打开它的一方关闭
+type writerSink struct {
+	zapcore.WriteSyncer
+}
+
+func (writerSink) Close() error {
+	return nil
+}
+
+func newWriterSink(u *url.URL) (zap.Sink, error) {
+	var v, ok = _writers.Load(u.Host)
+	if !ok {
+		return nil, fmt.Errorf("unknown writer %q", u.Host)
+	}
+	return writerSink{v.(zapcore.WriteSyncer)}, nil
+}
+
+func rotateURL(path string, r *Rotation) (string, error) {
+	if r.MaxSize <= 0 {
+		return "", fmt.Errorf("invalid rotation max size %d", r.MaxSize)
+	}
+	var abs, err = filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	var q = url.Values{}
+	q.Set("max_size", strconv.FormatInt(r.MaxSize, 10))
+	q.Set("max_backups", strconv.Itoa(r.MaxBackups))
+	return (&url.URL{Scheme: _ROTATE_SCHEME, Path: filepath.ToSlash(abs), RawQuery: q.Encode()}).String(), nil
+}
+
+// rotateSink 是一个按大小轮转的文件输出
+type rotateSink struct {
+	mu         sync.Mutex
+	path       string
+	maxSize    int64
+	maxBackups int
+
+	file *os.File
+	size int64
+}
+
+func newRotateSink(u *url.URL) (zap.Sink, error) {
+	var q = u.Query()
+	var maxSize, err = strconv.ParseInt(q.Get("max_size"), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid max_size, %w", err)
+	}
+	maxBackups, err := strconv.Atoi(q.Get("max_backups"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid max_backups, %w", err)
+	}
+
+	var s = &rotateSink{
+		path:       filepath.FromSlash(u.Path),
+		maxSize:    maxSize,
+		maxBackups: maxBackups,
+	}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *rotateSink) open() error {
+	var f, err = os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	s.file, s.size = f, info.Size()
+	return nil
+}
+
+// rotate 轮转文件，轮转失败时会重新打开当前文件继续写入，并在下一次写入时重试
+func (s *rotateSink) rotate() error {
+	var err = s.file.Close()
+	s.file = nil
+	if err == nil {
+		err = s.shift()
+	}
+	return errors.Join(err, s.open())
+}
+
+// shift 将当前文件及历史文件依次重命名，不保留历史文件时直接删除当前文件
+func (s *rotateSink) shift() error {
+	if s.maxBackups <= 0 {
+		return os.Remove(s.path)
+	}
+	for i := s.maxBackups - 1; i > 0; i-- {
+		var from = s.path + "." + strconv.Itoa(i)
+		if _, err := os.Stat(from); err == nil {
+			os.Rename(from, s.path+"."+strconv.Itoa(i+1))
+		}
+	}
+	return os.Rename(s.path, s.path+".1")
+}
+
+func (s *rotateSink) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file != nil && s.size > 0 && s.size+int64(len(p)) > s.maxSize {
+		// keep writing to the current file if failed
+		s.rotate()
+	}
+	if s.file == nil {
+		if err := s.open(); err != nil {
+			return 0, err
+		}
+	}
+	var n, err = s.file.Write(p)
+	s.size += int64(n)
+	return n, err
+}
+
+func (s *rotateSink) Sync() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		return nil
+	}
+	return s.file.Sync()
+}
+
+func (s *rotateSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		return nil
+	}
+	var err = s.file.Close()
+	s.file = nil
+	return err
+}
@@ -0,0 +1,188 @@
+package xiao
+
+import (
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestSinkLogger(t *testing.T) {
+	var dir = t.TempDir()
+	var all, errs = filepath.Join(dir, "all.log"), filepath.Join(dir, "sub", "error.log")
+	var logger, err = NewSinkLogger([]SinkConfig{
+		{Level: "debug", Path: all, Encoding: "json"},
+		{Level: "error", Path: errs, Encoding: "console"},
+	}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ReplaceLogger(logger)()
+
+	var ctx = NamedContext("TestSinkLogger").At("tee")
+	ctx.Debug("debug message")
+	ctx.Error("error message")
+	logger.Sync()
+
+	var b1, _ = os.ReadFile(all)
+	var b2, _ = os.ReadFile(errs)
+	if s := string(b1); !strings.Contains(s, `"M":"debug message"`) ||
+		!strings.Contains(s, `"M":"error message"`) || !strings.Contains(s, `"@":"tee"`) {
+		t.Errorf("unexpected json sink content: %s", s)
+	}
+	if s := string(b2); strings.Contains(s, "debug message") ||
+		!strings.Contains(s, "error message") || !strings.Contains(s, `"@": "tee"`) {
+		t.Errorf("unexpected console sink content: %s", s)
+	}
+}
+
+func TestSinkLoggerRecorded(t *testing.T) {
+	var dir = t.TempDir()
+	var info, errs = filepath.Join(dir, "info.log"), filepath.Join(dir, "error.log")
+	var logger, err = NewSinkLogger([]SinkConfig{
+		{Level: "info", Path: info, Encoding: "json"},
+		{Level: "error", Path: errs, Encoding: "json"},
+	}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ReplaceLogger(logger)()
+
+	var ctx, _ = RecordedSessionalContext(0)
+	ctx.Debug("recorded")
+	ctx.Error("failed")
+	logger.Sync()
+
+	var b1, _ = os.ReadFile(info)
+	var b2, _ = os.ReadFile(errs)
+	if !strings.Contains(string(b1), "recorded") {
+		t.Errorf("recorded entries should go to the most verbose sink")
+	}
+	if strings.Contains(string(b2), "recorded") {
+		t.Errorf("recorded entries should not go to the error sink")
+	}
+}
+
+func TestRotation(t *testing.T) {
+	var path = filepath.Join(t.TempDir(), "rotate.log")
+	var logger, err = NewSinkLogger([]SinkConfig{
+		{Level: "info", Path: path, Encoding: "json", Rotation: &Rotation{MaxSize: 200, MaxBackups: 2}},
+	}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 20; i++ {
+		logger.Info("rotate me please")
+	}
+	logger.Sync()
+
+	for _, name := range []string{path, path + ".1", path + ".2"} {
+		if info, err := os.Stat(name); err != nil {
+			t.Errorf("expect %s exists: %s", name, err)
+		} else if info.Size() > 200 {
+			t.Errorf("file %s too large: %d", name, info.Size())
+		}
+	}
+	if _, err := os.Stat(path + ".3"); err == nil {
+		t.Errorf("expect only 2 backups")
+	}
+}
+
+func TestRotationFailure(t *testing.T) {
+	var path = filepath.Join(t.TempDir(), "rotate.log")
+	// a non-empty directory makes renaming to path.1 fail
+	if err := os.MkdirAll(filepath.Join(path+".1", "busy"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	var logger, err = NewSinkLogger([]SinkConfig{
+		{Level: "info", Path: path, Encoding: "json", Rotation: &Rotation{MaxSize: 100, MaxBackups: 1}},
+	}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer CloseLogger(logger)
+	for i := 0; i < 5; i++ {
+		logger.Info("rotate me please")
+	}
+	logger.Sync()
+
+	var b, _ = os.ReadFile(path)
+	if n := strings.Count(string(b), "rotate me please"); n != 5 {
+		t.Errorf("expect writing to the current file when rotation failed, got %d entries", n)
+	}
+}
+
+const (
+	_TEST_CLOSED_SCHEME   = "xiao-test-closed"
+	_TEST_CUSTOM_ENCODING = "xiao-test-custom"
+)
+
+var _testSinkClosed atomic.Bool
+
+type closedSink struct {
+	zapcore.WriteSyncer
+}
+
+func (closedSink) Close() error {
+	_testSinkClosed.Store(true)
+	return nil
+}
+
+func init() {
+	if err := zap.RegisterSink(_TEST_CLOSED_SCHEME, func(*url.URL) (zap.Sink, error) {
+		return closedSink{zapcore.AddSync(io.Discard)}, nil
+	}); err != nil {
+		panic(err)
+	}
+	if err := zap.RegisterEncoder(_TEST_CUSTOM_ENCODING, func(cfg zapcore.EncoderConfig) (zapcore.Encoder, error) {
+		var enc = zapcore.NewJSONEncoder(cfg)
+		enc.AddString("custom", "yes")
+		return enc, nil
+	}); err != nil {
+		panic(err)
+	}
+}
+
+func TestSinkLoggerCustomEncoding(t *testing.T) {
+	var path = filepath.Join(t.TempDir(), "custom.log")
+	var logger, err = NewSimpleLogger("info", path, _TEST_CUSTOM_ENCODING, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger.Debug("dropped")
+	logger.Info("hello")
+	if err := CloseLogger(logger); err != nil {
+		t.Fatal(err)
+	}
+	var b, _ = os.ReadFile(path)
+	if s := string(b); strings.Contains(s, "dropped") || !strings.Contains(s, `"custom":"yes"`) || !strings.Contains(s, `"M":"hello"`) {
+		t.Errorf("unexpected output: %s", s)
+	}
+
+	_, err = NewSimpleLogger("info", path, _TEST_CUSTOM_ENCODING, false, WithAsync(AsyncConfig{}))
+	if err == nil {
+		t.Errorf("custom encoding is not supported by async output")
+	}
+}
+
+func TestSinkLoggerCloseOnError(t *testing.T) {
+	// the directory of the url path is created in the working directory
+	t.Chdir(t.TempDir())
+	_testSinkClosed.Store(false)
+	var _, err = NewSinkLogger([]SinkConfig{
+		{Level: "info", Path: _TEST_CLOSED_SCHEME + "://", Encoding: "json"},
+		{Level: "info", Path: "stderr", Encoding: "unknown"},
+	}, false)
+	if err == nil {
+		t.Fatal("expect error for unknown encoding")
+	}
+	if !_testSinkClosed.Load() {
+		t.Errorf("opened sinks should be closed on error")
+	}
+}
@@ -0,0 +1,334 @@
+package xiao
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// TraceID 是W3C Trace Context定义的16字节trace-id
+type TraceID [16]byte
+
+// SpanID 是W3C Trace Context定义的8字节span-id，也叫parent-id
+type SpanID [8]byte
+
+func (id TraceID) IsValid() bool  { return id != TraceID{} }
+func (id TraceID) String() string { return hex.EncodeToString(id[:]) }
+func (id SpanID) IsValid() bool   { return id != SpanID{} }
+func (id SpanID) String() string  { return hex.EncodeToString(id[:]) }
+
+func newTraceID() (id TraceID) {
+	for !id.IsValid() {
+		var hi, lo = rand.Uint64(), rand.Uint64()
+		for i := range 8 {
+			id[i], id[8+i] = byte(hi>>(56-8*i)), byte(lo>>(56-8*i))
+		}
+	}
+	return
+}
+
+func newSpanID() (id SpanID) {
+	for !id.IsValid() {
+		var v = rand.Uint64()
+		for i := range 8 {
+			id[i] = byte(v >> (56 - 8*i))
+		}
+	}
+	return
+}
+
+// sessionTraceID 尝试将session名称转换为trace-id，
+// SessionalContext生成的名称本身就是uuid格式(可能带有前缀和Fork后缀)，可以直接作为trace-id，
+// 这样日志中的session和trace就能够对应起来
+func sessionTraceID(session string) (TraceID, bool) {
+	if i := strings.IndexByte(session, '.'); i >= 0 {
+		session = session[:i]
+	}
+	if len(session) < 36 {
+		return TraceID{}, false
+	}
+	var u, err = uuid.Parse(session[len(session)-36:])
+	if err != nil || TraceID(u) == (TraceID{}) {
+		return TraceID{}, false
+	}
+	return TraceID(u), true
+}
+
+// SpanStatus 是Span的状态码，与OTLP的Status.code取值一致
+type SpanStatus int
+
+const (
+	SpanUnset SpanStatus = iota
+	SpanOK
+	SpanError
+)
+
+func (s SpanStatus) String() string {
+	switch s {
+	case SpanOK:
+		return "ok"
+	case SpanError:
+		return "error"
+	}
+	return "unset"
+}
+
+// SpanData 是Span结束时的快照，会被传递给SpanExporter
+type SpanData struct {
+	TraceID  TraceID
+	SpanID   SpanID
+	ParentID SpanID
+	// Remote 表示ParentID来自于上游服务，而不是本进程内的Span
+	Remote bool
+
+	Name string
+	// ContextName和Location是StartSpan时Context的名称和位置
+	ContextName string
+	Location    string
+
+	Start time.Time
+	End   time.Time
+
+	Attrs         []SpanAttr
+	Status        SpanStatus
+	StatusMessage string
+}
+
+// Duration 返回Span的持续时间
+func (d *SpanData) Duration() time.Duration {
+	return d.End.Sub(d.Start)
+}
+
+// SpanAttr 是Span的一个属性
+type SpanAttr struct {
+	Key   string
+	Value any
+}
+
+// Span 表示一次调用的执行过程，通过Context.StartSpan创建，调用End结束。
+// 在Span的Context上执行Fork/At/StartSpan产生的新Span，都会以它作为父级。
+// 所有方法在nil上调用都是安全的。
+type Span struct {
+	mu    sync.Mutex
+	data  SpanData
+	ended bool
+}
+
+type keySpan struct{}
+
+// remoteSpan 是通过traceparent提取出的上游Span
+type remoteSpan struct {
+	traceID TraceID
+	spanID  SpanID
+}
+
+// SpanFromContext 返回ctx当前所在的Span，没有时返回nil
+func SpanFromContext(ctx Context) *Span {
+	if v, ok := ctx.Get(keySpan{}); ok {
+		if span, ok := v.(*Span); ok {
+			return span
+		}
+	}
+	return nil
+}
+
+func startSpan(ctx Context, name string) (Context, *Span) {
+	var newctx = ctx.At(name)
+	var span = &Span{data: SpanData{
+		SpanID:      newSpanID(),
+		Name:        name,
+		ContextName: newctx.Name(),
+		Location:    newctx.Location(),
+		Start:       time.Now(),
+	}}
+
+	if v, ok := ctx.Get(keySpan{}); ok {
+		switch parent := v.(type) {
+		case *Span:
+			span.data.TraceID, span.data.ParentID = parent.data.TraceID, parent.data.SpanID
+		case remoteSpan:
+			span.data.TraceID, span.data.ParentID = parent.traceID, parent.spanID
+			span.data.Remote = true
+		}
+	}
+	if !span.data.TraceID.IsValid() {
+		var ok bool
+		if span.data.TraceID, ok = sessionTraceID(GetSession(ctx)); !ok {
+			span.data.TraceID = newTraceID()
+		}
+	}
+
+	newctx.Set(keySpan{}, span)
+	return newctx, span
+}
+
+// TraceID 返回Span的trace-id
+func (s *Span) TraceID() TraceID {
+	if s == nil {
+		return TraceID{}
+	}
+	return s.data.TraceID
+}
+
+// SpanID 返回Span的span-id
+func (s *Span) SpanID() SpanID {
+	if s == nil {
+		return SpanID{}
+	}
+	return s.data.SpanID
+}
+
+// TraceParent 返回W3C traceparent格式的字符串，用于向下游传播
+func (s *Span) TraceParent() string {
+	if s == nil {
+		return ""
+	}
+	return fmt.Sprintf("00-%s-%s-01", s.data.TraceID, s.data.SpanID)
+}
+
+// SetAttr 以key/value对的形式设置属性，相同的key会覆盖之前的值
+func (s *Span) SetAttr(kvs ...any) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ended {
+		return
+	}
+next:
+	for i := 0; i+1 < len(kvs); i += 2 {
+		var key, ok = kvs[i].(string)
+		if !ok {
+			key = fmt.Sprint(kvs[i])
+		}
+		for j := range s.data.Attrs {
+			if s.data.Attrs[j].Key == key {
+				s.data.Attrs[j].Value = kvs[i+1]
+				continue next
+			}
+		}
+		s.data.Attrs = append(s.data.Attrs, SpanAttr{Key: key, Value: kvs[i+1]})
+	}
+}
+
+// SetStatus 设置Span的状态
+func (s *Span) SetStatus(status SpanStatus, message string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ended {
+		return
+	}
+	s.data.Status, s.data.StatusMessage = status, message
+}
+
+// SetError 在err不为nil时，将Span的状态设置为SpanError，并返回err本身，
+// 便于 return span.SetError(err) 的写法
+func (s *Span) SetError(err error) error {
+	if err != nil {
+		s.SetStatus(SpanError, err.Error())
+	}
+	return err
+}
+
+// End 结束Span并交给当前的SpanExporter，只有第一次调用有效
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.End = time.Now()
+	var data = s.data
+	data.Attrs = append([]SpanAttr(nil), s.data.Attrs...)
+	s.mu.Unlock()
+
+	if e := _spanExporter.Load(); e != nil {
+		(*e).ExportSpan(&data)
+	}
+}
+
+// SpanExporter 用于导出已经结束的Span，ExportSpan会在Span.End中被同步调用
+type SpanExporter interface {
+	ExportSpan(*SpanData)
+}
+
+var _spanExporter atomic.Pointer[SpanExporter]
+
+// UseSpanExporter 设置全局的SpanExporter，nil表示不导出，返回的函数用于恢复之前的设置
+func UseSpanExporter(e SpanExporter) func() {
+	var prev *SpanExporter
+	if e == nil {
+		prev = _spanExporter.Swap(nil)
+	} else {
+		prev = _spanExporter.Swap(&e)
+	}
+	return func() {
+		if prev == nil {
+			UseSpanExporter(nil)
+		} else {
+			UseSpanExporter(*prev)
+		}
+	}
+}
+
+// TraceParentHeader 是W3C Trace Context规定的http header名称
+const TraceParentHeader = "traceparent"
+
+// ParseTraceParent 解析W3C traceparent格式的字符串
+func ParseTraceParent(s string) (TraceID, SpanID, error) {
+	var traceID TraceID
+	var spanID SpanID
+	var parts = strings.Split(strings.TrimSpace(s), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || (parts[0] == "00" && len(parts) != 4) {
+		return traceID, spanID, errors.New("invalid traceparent")
+	}
+	if len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return traceID, spanID, errors.New("invalid traceparent")
+	}
+	if _, err := hex.Decode(traceID[:], []byte(parts[1])); err != nil || !traceID.IsValid() {
+		return traceID, spanID, errors.New("invalid traceparent trace-id")
+	}
+	if _, err := hex.Decode(spanID[:], []byte(parts[2])); err != nil || !spanID.IsValid() {
+		return traceID, spanID, errors.New("invalid traceparent parent-id")
+	}
+	return traceID, spanID, nil
+}
+
+// InjectTraceParent 将ctx当前所在Span的traceparent写入header，没有Span时什么也不做
+func InjectTraceParent(ctx Context, header http.Header) {
+	if span := SpanFromContext(ctx); span != nil {
+		header.Set(TraceParentHeader, span.TraceParent())
+	}
+}
+
+// ExtractTraceParent 从header中提取上游的traceparent，返回的Context中新建的Span会以它为父级。
+// 如果ctx还没有设置真实session，会将trace-id以uuid的格式设置为session，
+// 使得上下游日志中的session一致。header中没有合法的traceparent时直接返回ctx。
+func ExtractTraceParent(ctx Context, header http.Header) Context {
+	var traceID, spanID, err = ParseTraceParent(header.Get(TraceParentHeader))
+	if err != nil {
+		return ctx
+	}
+	var newctx = ctx.At("")
+	newctx.Set(keySpan{}, remoteSpan{traceID: traceID, spanID: spanID})
+	if GetRealSession(newctx) == "" {
+		SetSession(newctx, uuid.UUID(traceID).String())
+	}
+	return newctx
+}
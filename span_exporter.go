@@ -0,0 +1,324 @@
+package xiao
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LogSpanExporter 将结束的Span以日志的形式输出，日志的名称和位置与StartSpan时的Context一致
+type LogSpanExporter struct {
+	// Level 为输出日志的等级，状态为SpanError的Span总是使用Warn及以上等级
+	Level Level
+}
+
+func (e LogSpanExporter) ExportSpan(d *SpanData) {
+	var kvs = make([]any, 0, 12+2*len(d.Attrs))
+	kvs = append(kvs,
+		"trace_id", d.TraceID.String(),
+		"span_id", d.SpanID.String(),
+		"duration", d.Duration(),
+		"status", d.Status.String(),
+	)
+	if d.ParentID.IsValid() {
+		kvs = append(kvs, "parent_id", d.ParentID.String())
+	}
+	if d.StatusMessage != "" {
+		kvs = append(kvs, "status_message", d.StatusMessage)
+	}
+	for _, attr := range d.Attrs {
+		kvs = append(kvs, attr.Key, attr.Value)
+	}
+
+	var log = NewLogger(d.ContextName, d.Location, _S, nil, nil)
+	var msg = "span " + d.Name + " ended"
+	switch lvl := e.Level; {
+	case d.Status == SpanError && lvl < WarnLevel:
+		log.Warn(msg, kvs...)
+	case lvl <= DebugLevel:
+		log.Debug(msg, kvs...)
+	case lvl == InfoLevel:
+		log.Info(msg, kvs...)
+	case lvl == WarnLevel:
+		log.Warn(msg, kvs...)
+	default:
+		log.Error(msg, kvs...)
+	}
+}
+
+// MemorySpanExporter 将结束的Span保存在内存中，一般用于测试
+type MemorySpanExporter struct {
+	mu    sync.Mutex
+	spans []*SpanData
+}
+
+// NewMemorySpanExporter 返回一个空的MemorySpanExporter
+func NewMemorySpanExporter() *MemorySpanExporter {
+	return &MemorySpanExporter{}
+}
+
+func (e *MemorySpanExporter) ExportSpan(d *SpanData) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = append(e.spans, d)
+}
+
+// Spans 返回所有已导出的Span，按结束的先后顺序排列
+func (e *MemorySpanExporter) Spans() []*SpanData {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]*SpanData(nil), e.spans...)
+}
+
+// Reset 清空所有已导出的Span
+func (e *MemorySpanExporter) Reset() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = nil
+}
+
+const (
+	_OTLP_BATCH_SIZE     = 512
+	_OTLP_FLUSH_INTERVAL = 5 * time.Second
+	_OTLP_SCOPE_NAME     = "github.com/cjey/xiao"
+)
+
+// OTLPSpanExporter 将Span编码为OTLP/JSON格式(ExportTraceServiceRequest)，
+// 写入文件(每批一行)或者POST到OTLP/HTTP collector，例如http://127.0.0.1:4318/v1/traces。
+// Span会先被缓存，满一批或者每隔一段时间写出一次，退出前应当调用Close。
+type OTLPSpanExporter struct {
+	service  string
+	endpoint string
+	file     *os.File
+	client   *http.Client
+
+	mu    sync.Mutex
+	spans []*SpanData
+	full  chan struct{}
+	done  chan struct{}
+	wg    sync.WaitGroup
+	once  sync.Once
+}
+
+// NewOTLPSpanExporter 返回一个OTLPSpanExporter，endpoint以http://或https://开头时作为collector地址，
+// 否则作为文件路径，以追加的方式写入。service会作为resource的service.name属性。
+func NewOTLPSpanExporter(endpoint, service string) (*OTLPSpanExporter, error) {
+	var e = &OTLPSpanExporter{
+		service:  service,
+		endpoint: endpoint,
+		full:     make(chan struct{}, 1),
+		done:     make(chan struct{}),
+	}
+	if strings.HasPrefix(endpoint, "http://") || strings.HasPrefix(endpoint, "https://") {
+		e.client = &http.Client{Timeout: 10 * time.Second}
+	} else {
+		if err := os.MkdirAll(filepath.Dir(endpoint), 0755); err != nil {
+			return nil, err
+		}
+		var f, err = os.OpenFile(endpoint, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+		if err != nil {
+			return nil, err
+		}
+		e.file = f
+	}
+
+	e.wg.Add(1)
+	go e.loop()
+	return e, nil
+}
+
+func (e *OTLPSpanExporter) ExportSpan(d *SpanData) {
+	e.mu.Lock()
+	e.spans = append(e.spans, d)
+	var full = len(e.spans) >= _OTLP_BATCH_SIZE
+	e.mu.Unlock()
+	if full {
+		select {
+		case e.full <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (e *OTLPSpanExporter) loop() {
+	defer e.wg.Done()
+	var ticker = time.NewTicker(_OTLP_FLUSH_INTERVAL)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-e.done:
+			return
+		case <-ticker.C:
+		case <-e.full:
+		}
+		if err := e.Flush(); err != nil {
+			_S.Warnw("export spans failed", "endpoint", e.endpoint, "error", err)
+		}
+	}
+}
+
+// Flush 立即写出所有缓存的Span
+func (e *OTLPSpanExporter) Flush() error {
+	e.mu.Lock()
+	var spans = e.spans
+	e.spans = nil
+	e.mu.Unlock()
+	if len(spans) == 0 {
+		return nil
+	}
+
+	var body, err = json.Marshal(otlpRequest(e.service, spans))
+	if err != nil {
+		return err
+	}
+	if e.file != nil {
+		_, err = e.file.Write(append(body, '\n'))
+		return err
+	}
+
+	resp, err := e.client.Post(e.endpoint, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+	return nil
+}
+
+// Close 写出所有缓存的Span并停止后台任务
+func (e *OTLPSpanExporter) Close() error {
+	e.once.Do(func() {
+		close(e.done)
+		e.wg.Wait()
+	})
+	var err = e.Flush()
+	if e.file != nil {
+		if err2 := e.file.Close(); err == nil {
+			err = err2
+		}
+	}
+	return err
+}
+
+// OTLP/JSON encoding, see opentelemetry-proto trace/v1/trace.proto,
+// ids are hex encoded and 64 bits integers are strings
+type (
+	otlpTraces struct {
+		ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+	}
+	otlpResourceSpans struct {
+		Resource   otlpResource     `json:"resource"`
+		ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+	}
+	otlpResource struct {
+		Attributes []otlpKeyValue `json:"attributes"`
+	}
+	otlpScopeSpans struct {
+		Scope otlpScope  `json:"scope"`
+		Spans []otlpSpan `json:"spans"`
+	}
+	otlpScope struct {
+		Name string `json:"name"`
+	}
+	otlpSpan struct {
+		TraceID           string         `json:"traceId"`
+		SpanID            string         `json:"spanId"`
+		ParentSpanID      string         `json:"parentSpanId,omitempty"`
+		Name              string         `json:"name"`
+		Kind              int            `json:"kind"`
+		StartTimeUnixNano string         `json:"startTimeUnixNano"`
+		EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+		Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+		Status            otlpStatus     `json:"status"`
+	}
+	otlpStatus struct {
+		Code    int    `json:"code,omitempty"`
+		Message string `json:"message,omitempty"`
+	}
+	otlpKeyValue struct {
+		Key   string       `json:"key"`
+		Value otlpAnyValue `json:"value"`
+	}
+	otlpAnyValue struct {
+		StringValue *string  `json:"stringValue,omitempty"`
+		BoolValue   *bool    `json:"boolValue,omitempty"`
+		IntValue    *string  `json:"intValue,omitempty"`
+		DoubleValue *float64 `json:"doubleValue,omitempty"`
+	}
+)
+
+const (
+	_OTLP_SPAN_KIND_INTERNAL = 1
+	_OTLP_SPAN_KIND_SERVER   = 2
+)
+
+func otlpString(key, value string) otlpKeyValue {
+	return otlpKeyValue{Key: key, Value: otlpAnyValue{StringValue: &value}}
+}
+
+func otlpAttr(key string, value any) otlpKeyValue {
+	var v otlpAnyValue
+	switch x := value.(type) {
+	case string:
+		v.StringValue = &x
+	case bool:
+		v.BoolValue = &x
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		var s = fmt.Sprint(x)
+		v.IntValue = &s
+	case float32:
+		var f = float64(x)
+		v.DoubleValue = &f
+	case float64:
+		v.DoubleValue = &x
+	default:
+		var s = fmt.Sprint(x)
+		v.StringValue = &s
+	}
+	return otlpKeyValue{Key: key, Value: v}
+}
+
+func otlpRequest(service string, spans []*SpanData) *otlpTraces {
+	var scope = otlpScopeSpans{
+		Scope: otlpScope{Name: _OTLP_SCOPE_NAME},
+		Spans: make([]otlpSpan, 0, len(spans)),
+	}
+	for _, d := range spans {
+		var span = otlpSpan{
+			TraceID:           d.TraceID.String(),
+			SpanID:            d.SpanID.String(),
+			Name:              d.Name,
+			Kind:              _OTLP_SPAN_KIND_INTERNAL,
+			StartTimeUnixNano: strconv.FormatInt(d.Start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(d.End.UnixNano(), 10),
+			Status:            otlpStatus{Code: int(d.Status), Message: d.StatusMessage},
+		}
+		if d.ParentID.IsValid() {
+			span.ParentSpanID = d.ParentID.String()
+		}
+		if d.Remote {
+			span.Kind = _OTLP_SPAN_KIND_SERVER
+		}
+		span.Attributes = append(span.Attributes, otlpString("xiao.name", d.ContextName))
+		if d.Location != "" {
+			span.Attributes = append(span.Attributes, otlpString("xiao.location", d.Location))
+		}
+		for _, attr := range d.Attrs {
+			span.Attributes = append(span.Attributes, otlpAttr(attr.Key, attr.Value))
+		}
+		scope.Spans = append(scope.Spans, span)
+	}
+	return &otlpTraces{ResourceSpans: []otlpResourceSpans{{
+		Resource:   otlpResource{Attributes: []otlpKeyValue{otlpString("service.name", service)}},
+		ScopeSpans: []otlpScopeSpans{scope},
+	}}}
+}
@@ -0,0 +1,155 @@
+package xiao
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestSpan(t *testing.T) {
+	var exporter = NewMemorySpanExporter()
+	defer UseSpanExporter(exporter)()
+
+	var ctx = SessionalContext()
+	var hctx, root = ctx.StartSpan("Handle")
+	root.SetAttr("user", "cjey", "retry", 1)
+	var qctx, query = hctx.Fork().StartSpan("Query")
+	if qctx.Location() != "Handle/Query" || SpanFromContext(qctx) != query {
+		t.Errorf("unexpected span context: %s", qctx.Location())
+	}
+	query.SetError(errors.New("timeout"))
+	query.End()
+	root.End()
+	root.End()
+
+	var spans = exporter.Spans()
+	if len(spans) != 2 {
+		t.Fatalf("expect 2 spans, got %d", len(spans))
+	}
+	var session = uuid.MustParse(ctx.Name())
+	if spans[1].TraceID != TraceID(session) || spans[0].TraceID != spans[1].TraceID {
+		t.Errorf("trace-id should be derived from session name")
+	}
+	if spans[1].ParentID.IsValid() || spans[0].ParentID != spans[1].SpanID {
+		t.Errorf("unexpected parent relation")
+	}
+	if spans[0].Status != SpanError || spans[0].StatusMessage != "timeout" || spans[0].ContextName != ctx.Name()+".1" {
+		t.Errorf("unexpected query span: %+v", spans[0])
+	}
+	if len(spans[1].Attrs) != 2 || spans[1].Attrs[1].Value != 1 {
+		t.Errorf("unexpected attrs: %+v", spans[1].Attrs)
+	}
+
+	// propagation
+	var header = http.Header{}
+	InjectTraceParent(qctx, header)
+	var tp = header.Get(TraceParentHeader)
+	if tp != "00-"+strings.ReplaceAll(ctx.Name(), "-", "")+"-"+query.SpanID().String()+"-01" {
+		t.Errorf("unexpected traceparent: %s", tp)
+	}
+	var remote = ExtractTraceParent(SessionalContext(), header)
+	if GetSession(remote) != ctx.Name() {
+		t.Errorf("session should be set by traceparent: %s", GetSession(remote))
+	}
+	exporter.Reset()
+	_, server := remote.StartSpan("Serve")
+	server.End()
+	if spans = exporter.Spans(); len(spans) != 1 || !spans[0].Remote ||
+		spans[0].TraceID != query.TraceID() || spans[0].ParentID != query.SpanID() {
+		t.Errorf("unexpected remote child: %+v", spans)
+	}
+
+	for _, bad := range []string{"", "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331", "00-00000000000000000000000000000000-b7ad6b7169203331-01", "ff-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"} {
+		if _, _, err := ParseTraceParent(bad); err == nil {
+			t.Errorf("expect error for %q", bad)
+		}
+	}
+	if _, _, err := ParseTraceParent("01-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01-future"); err != nil {
+		t.Errorf("future versions should be accepted: %v", err)
+	}
+
+	// nil span is safe
+	var nilSpan *Span
+	nilSpan.SetAttr("k", "v")
+	nilSpan.End()
+	if SpanFromContext(NamedContext("none")) != nil {
+		t.Errorf("unexpected span")
+	}
+}
+
+func TestLogSpanExporter(t *testing.T) {
+	var path = filepath.Join(t.TempDir(), "span.log")
+	var logger, err = NewSimpleLogger("info", path, "json", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ReplaceLogger(logger)()
+	defer UseSpanExporter(LogSpanExporter{Level: InfoLevel})()
+
+	var _, span = NamedContext("TestLogSpanExporter").StartSpan("Work")
+	span.SetAttr("n", 3)
+	span.End()
+	logger.Sync()
+
+	var b, _ = os.ReadFile(path)
+	if s := string(b); !strings.Contains(s, `"N":"TestLogSpanExporter","M":"span Work ended","@":"Work","trace_id":"`) ||
+		!strings.Contains(s, `"status":"unset","n":3`) {
+		t.Errorf("unexpected output: %s", s)
+	}
+}
+
+func TestOTLPSpanExporter(t *testing.T) {
+	var bodies = make(chan []byte, 1)
+	var srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var b, _ = io.ReadAll(r.Body)
+		bodies <- b
+	}))
+	defer srv.Close()
+
+	var path = filepath.Join(t.TempDir(), "traces", "spans.json")
+	for _, endpoint := range []string{srv.URL + "/v1/traces", path} {
+		var exporter, err = NewOTLPSpanExporter(endpoint, "xiao-test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var restore = UseSpanExporter(exporter)
+		var ctx, parent = SessionalContext().StartSpan("Handle")
+		var _, child = ctx.StartSpan("Query")
+		child.SetAttr("rows", 10, "ok", true, "ratio", 0.5)
+		child.SetStatus(SpanOK, "")
+		child.End()
+		parent.End()
+		restore()
+		if err := exporter.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		var body []byte
+		if endpoint == path {
+			body, _ = os.ReadFile(path)
+		} else {
+			body = <-bodies
+		}
+		var req otlpTraces
+		if err := json.Unmarshal(body, &req); err != nil {
+			t.Fatalf("bad otlp json: %v: %s", err, body)
+		}
+		var rs = req.ResourceSpans[0]
+		if *rs.Resource.Attributes[0].Value.StringValue != "xiao-test" || len(rs.ScopeSpans[0].Spans) != 2 {
+			t.Fatalf("unexpected request: %s", body)
+		}
+		var s = rs.ScopeSpans[0].Spans[0]
+		if s.Name != "Query" || s.TraceID != child.TraceID().String() || s.ParentSpanID != parent.SpanID().String() ||
+			s.Status.Code != 1 || !strings.Contains(string(body), `{"key":"rows","value":{"intValue":"10"}}`) {
+			t.Errorf("unexpected span: %s", body)
+		}
+	}
+}
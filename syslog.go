@@ -0,0 +1,405 @@
+package xiao
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// 以下形式的SinkConfig.Path会被作为系统日志输出，此时Encoding参数会被忽略
+//
+//	syslog://                      本地syslog，依次尝试/dev/log、/var/run/syslog、/var/run/log
+//	syslog:///dev/log              指定路径的本地syslog，优先使用unixgram，不支持时使用unix流式socket并以换行符分帧
+//	syslog+udp://127.0.0.1:514     UDP协议的远程syslog
+//	syslog+tcp://127.0.0.1:601     TCP协议的远程syslog，使用octet counting分帧
+//	journald://                    journald原生协议，默认路径/run/systemd/journal/socket
+//	journald:///path/to/socket     指定路径的journald
+//
+// syslog均使用RFC 5424格式输出，支持以下查询参数
+//
+//	app       APP-NAME，默认为当前程序名
+//	facility  设施，例如user、daemon、local0，默认user
+//
+// journald支持app查询参数，对应SYSLOG_IDENTIFIER字段
+const (
+	_SCHEME_SYSLOG     = "syslog"
+	_SCHEME_SYSLOG_UDP = "syslog+udp"
+	_SCHEME_SYSLOG_TCP = "syslog+tcp"
+	_SCHEME_JOURNALD   = "journald"
+)
+
+// 用于RFC 5424 structured data的私有企业号，32473为文档示例保留号
+const _SYSLOG_PEN = "32473"
+
+// parseRecordSink 判断给定路径是否为系统日志输出
+func parseRecordSink(path string) (*url.URL, bool) {
+	var i = strings.Index(path, "://")
+	if i < 0 {
+		return nil, false
+	}
+	switch path[:i] {
+	case _SCHEME_SYSLOG, _SCHEME_SYSLOG_UDP, _SCHEME_SYSLOG_TCP, _SCHEME_JOURNALD:
+	default:
+		return nil, false
+	}
+	var u, err = url.Parse(path)
+	if err != nil {
+		return nil, false
+	}
+	return u, true
+}
+
+func newRecordCore(u *url.URL, enab zapcore.LevelEnabler) (*recordCore, error) {
+	var app = u.Query().Get("app")
+	if app == "" {
+		app = filepath.Base(os.Args[0])
+	}
+
+	var w recordWriter
+	var err error
+	if u.Scheme == _SCHEME_JOURNALD {
+		w, err = newJournaldWriter(u.Path, app)
+	} else {
+		w, err = newSyslogWriter(u, app)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &recordCore{LevelEnabler: enab, out: w}, nil
+}
+
+// logRecord 是一条已经拆分好的日志，供syslog和journald这类结构化输出使用
+type logRecord struct {
+	zapcore.Entry
+	Location string
+	Keys     []string // sorted keys of Fields
+	Fields   map[string]any
+}
+
+// Session 返回名称中第一个Fork之前的部分，即最初的session名称
+func (r *logRecord) Session() string {
+	if i := strings.IndexByte(r.LoggerName, '.'); i >= 0 {
+		return r.LoggerName[:i]
+	}
+	return r.LoggerName
+}
+
+// FieldString 将字段的值转换为字符串，复杂类型使用json编码
+func (r *logRecord) FieldString(key string) string {
+	switch v := r.Fields[key].(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	case fmt.Stringer:
+		return v.String()
+	case bool, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		return fmt.Sprint(v)
+	default:
+		var b, err = json.Marshal(v)
+		if err != nil {
+			return fmt.Sprint(v)
+		}
+		return string(b)
+	}
+}
+
+type recordWriter interface {
+	WriteRecord(r *logRecord) error
+	Sync() error
+	Close() error
+}
+
+// recordCore 将日志拆分为logRecord后交给recordWriter输出
+type recordCore struct {
+	zapcore.LevelEnabler
+	fields []zapcore.Field
+	out    recordWriter
+}
+
+func (c *recordCore) Level() zapcore.Level {
+	return zapcore.LevelOf(c.LevelEnabler)
+}
+
+func (c *recordCore) With(fields []zapcore.Field) zapcore.Core {
+	var c2 = &recordCore{
+		LevelEnabler: c.LevelEnabler,
+		fields:       make([]zapcore.Field, 0, len(c.fields)+len(fields)),
+		out:          c.out,
+	}
+	c2.fields = append(c2.fields, c.fields...)
+	c2.fields = append(c2.fields, fields...)
+	return c2
+}
+
+func (c *recordCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *recordCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	var enc = zapcore.NewMapObjectEncoder()
+	for i := range c.fields {
+		c.fields[i].AddTo(enc)
+	}
+	for i := range fields {
+		fields[i].AddTo(enc)
+	}
+
+	var r = &logRecord{Entry: ent, Fields: enc.Fields}
+	if loc, ok := r.Fields[locationKey].(string); ok {
+		r.Location = loc
+		delete(r.Fields, locationKey)
+	}
+	r.Keys = make([]string, 0, len(r.Fields))
+	for k := range r.Fields {
+		r.Keys = append(r.Keys, k)
+	}
+	sort.Strings(r.Keys)
+
+	if err := c.out.WriteRecord(r); err != nil {
+		return err
+	}
+	if ent.Level > zapcore.ErrorLevel {
+		return c.Sync()
+	}
+	return nil
+}
+
+func (c *recordCore) Sync() error {
+	return c.out.Sync()
+}
+
+// Close 关闭输出，由CloseLogger调用
+func (c *recordCore) Close() error {
+	return c.out.Close()
+}
+
+// syslogSeverity 将日志等级转换为syslog的severity
+func syslogSeverity(lvl zapcore.Level) int {
+	switch lvl {
+	case zapcore.DebugLevel:
+		return 7
+	case zapcore.InfoLevel:
+		return 6
+	case zapcore.WarnLevel:
+		return 4
+	case zapcore.ErrorLevel:
+		return 3
+	default:
+		return 2
+	}
+}
+
+var _syslogFacilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5, "lpr": 6, "news": 7,
+	"uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19,
+	"local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+type syslogWriter struct {
+	network  string
+	address  string
+	facility int
+	app      string
+	hostname string
+	pid      string
+
+	mu     sync.Mutex
+	conn   net.Conn
+	stream bool // whether conn is a stream socket, which needs framing
+}
+
+func newSyslogWriter(u *url.URL, app string) (*syslogWriter, error) {
+	var w = &syslogWriter{
+		facility: 1,
+		app:      syslogToken(app, 48),
+		hostname: "-",
+		pid:      strconv.Itoa(os.Getpid()),
+	}
+	if name, err := os.Hostname(); err == nil {
+		w.hostname = syslogToken(name, 255)
+	}
+	if f := u.Query().Get("facility"); f != "" {
+		var n, ok = _syslogFacilities[strings.ToLower(f)]
+		if !ok {
+			return nil, fmt.Errorf("unknown syslog facility %q", f)
+		}
+		w.facility = n
+	}
+
+	switch u.Scheme {
+	case _SCHEME_SYSLOG_UDP:
+		w.network, w.address = "udp", u.Host
+	case _SCHEME_SYSLOG_TCP:
+		w.network, w.address = "tcp", u.Host
+	default:
+		w.network, w.address = "unixgram", u.Path
+	}
+	if err := w.connect(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *syslogWriter) connect() error {
+	if w.network != "unixgram" {
+		var conn, err = net.DialTimeout(w.network, w.address, 5*time.Second)
+		if err != nil {
+			return err
+		}
+		w.conn, w.stream = conn, w.network == "tcp"
+		return nil
+	}
+
+	var paths = []string{w.address}
+	if w.address == "" {
+		paths = []string{"/dev/log", "/var/run/syslog", "/var/run/log"}
+	}
+	var err error
+	for _, path := range paths {
+		for _, network := range []string{"unixgram", "unix"} {
+			var conn net.Conn
+			if conn, err = net.Dial(network, path); err == nil {
+				w.conn, w.stream = conn, network == "unix"
+				return nil
+			}
+		}
+	}
+	return err
+}
+
+// syslogToken 将给定字符串转换为仅包含可打印ASCII字符的token，空字符串转换为"-"
+func syslogToken(s string, size int) string {
+	var b = make([]byte, 0, min(len(s), size))
+	for i := 0; i < len(s) && len(b) < size; i++ {
+		if c := s[i]; c > ' ' && c < 0x7f {
+			b = append(b, c)
+		}
+	}
+	if len(b) == 0 {
+		return "-"
+	}
+	return string(b)
+}
+
+// syslogParamName 将给定字符串转换为合法的SD-NAME
+func syslogParamName(s string) string {
+	var b = make([]byte, 0, min(len(s), 32))
+	for i := 0; i < len(s) && len(b) < 32; i++ {
+		switch c := s[i]; {
+		case c <= ' ' || c >= 0x7f || c == '=' || c == ']' || c == '"':
+			b = append(b, '_')
+		default:
+			b = append(b, c)
+		}
+	}
+	if len(b) == 0 {
+		return "_"
+	}
+	return string(b)
+}
+
+var _syslogParamEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`)
+
+func (w *syslogWriter) format(r *logRecord) []byte {
+	var sb strings.Builder
+	sb.WriteByte('<')
+	sb.WriteString(strconv.Itoa(w.facility*8 + syslogSeverity(r.Level)))
+	sb.WriteString(">1 ")
+	sb.WriteString(r.Time.Format("2006-01-02T15:04:05.000000Z07:00"))
+	sb.WriteByte(' ')
+	sb.WriteString(w.hostname)
+	sb.WriteByte(' ')
+	sb.WriteString(w.app)
+	sb.WriteByte(' ')
+	sb.WriteString(w.pid)
+	sb.WriteByte(' ')
+	sb.WriteString(syslogToken(r.LoggerName, 32))
+	sb.WriteByte(' ')
+
+	var param = func(name, value string) {
+		sb.WriteByte(' ')
+		sb.WriteString(syslogParamName(name))
+		sb.WriteString(`="`)
+		sb.WriteString(_syslogParamEscaper.Replace(value))
+		sb.WriteByte('"')
+	}
+
+	sb.WriteString("[xiao@" + _SYSLOG_PEN)
+	if r.LoggerName != "" {
+		param("name", r.LoggerName)
+		param("session", r.Session())
+	}
+	if r.Location != "" {
+		param("location", r.Location)
+	}
+	if r.Caller.Defined {
+		param("caller", r.Caller.TrimmedPath())
+	}
+	sb.WriteByte(']')
+	if len(r.Keys) > 0 {
+		sb.WriteString("[fields@" + _SYSLOG_PEN)
+		for _, k := range r.Keys {
+			param(k, r.FieldString(k))
+		}
+		sb.WriteByte(']')
+	}
+
+	if r.Message != "" {
+		sb.WriteByte(' ')
+		sb.WriteString(r.Message)
+	}
+	return []byte(sb.String())
+}
+
+// frame 为流式连接的消息分帧，TCP使用octet counting，本地的unix流式socket使用换行符结尾
+func (w *syslogWriter) frame(msg []byte) []byte {
+	switch {
+	case !w.stream:
+		return msg
+	case w.network == "tcp":
+		return append([]byte(strconv.Itoa(len(msg))+" "), msg...)
+	default:
+		return append(msg, '\n')
+	}
+}
+
+func (w *syslogWriter) WriteRecord(r *logRecord) error {
+	var msg = w.format(r)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var _, err = w.conn.Write(w.frame(msg))
+	if err != nil {
+		// try to reconnect once, the connection type may change
+		w.conn.Close()
+		if err = w.connect(); err == nil {
+			_, err = w.conn.Write(w.frame(msg))
+		}
+	}
+	return err
+}
+
+func (w *syslogWriter) Sync() error {
+	return nil
+}
+
+func (w *syslogWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.conn.Close()
+}
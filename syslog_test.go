@@ -0,0 +1,140 @@
+package xiao
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+func TestSyslogSink(t *testing.T) {
+	var pc, err = net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+
+	logger, err := NewSimpleLogger("info", "syslog+udp://"+pc.LocalAddr().String()+"?app=xiaotest&facility=local0", "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ReplaceLogger(logger)()
+	NamedContext("TestSyslog").At("udp").Warn("hello syslog", "user", `cj"ey`)
+
+	var buf = make([]byte, 4096)
+	pc.SetReadDeadline(time.Now().Add(3 * time.Second))
+	n, _, err := pc.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var msg = string(buf[:n])
+	for _, expect := range []string{
+		"<132>1 ", " xiaotest ", " TestSyslog [xiao@32473 name=\"TestSyslog\" session=\"TestSyslog\" location=\"udp\" caller=\"",
+		`[fields@32473 user="cj\"ey"] hello syslog`,
+	} {
+		if !strings.Contains(msg, expect) {
+			t.Errorf("expect %q in %q", expect, msg)
+		}
+	}
+}
+
+func TestSyslogUnixStream(t *testing.T) {
+	var path = filepath.Join(t.TempDir(), "log.sock")
+	var ln, err = net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	logger, err := NewSimpleLogger("info", "syslog://"+path, "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ReplaceLogger(logger)()
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	var ctx = NamedContext("TestSyslogUnixStream")
+	ctx.Info("first")
+	ctx.Info("second")
+
+	conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+	var r = bufio.NewReader(conn)
+	for _, expect := range []string{"first", "second"} {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(line, "<14>1 ") || !strings.HasSuffix(line, " "+expect+"\n") {
+			t.Errorf("expect a line ended with %q, got %q", expect, line)
+		}
+	}
+}
+
+func TestJournaldSink(t *testing.T) {
+	var path = filepath.Join(t.TempDir(), "journal.sock")
+	var conn, err = net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	logger, err := NewSimpleLogger("debug", "journald://"+path+"?app=xiaotest", "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ReplaceLogger(logger)()
+	NamedContext("TestJournald").Fork().At("unix").Error("hello\njournald", "user-id", 1)
+
+	var buf = make([]byte, 4096)
+	conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var msg = buf[:n]
+	for _, expect := range []string{
+		"MESSAGE\n\x0e\x00\x00\x00\x00\x00\x00\x00hello\njournald\n",
+		"PRIORITY=3\n", "SYSLOG_IDENTIFIER=xiaotest\n",
+		"XIAO_NAME=TestJournald.1\n", "XIAO_SESSION=TestJournald\n", "XIAO_LOCATION=unix\n",
+		"CODE_FILE=", "USER_ID=1\n",
+	} {
+		if !bytes.Contains(msg, []byte(expect)) {
+			t.Errorf("expect %q in %q", expect, msg)
+		}
+	}
+}
+
+func TestJournaldFieldName(t *testing.T) {
+	for k, expect := range map[string]string{
+		"user-id":   "USER_ID",
+		"message":   "XIAO_MESSAGE",
+		"priority":  "XIAO_PRIORITY",
+		"syslog_id": "XIAO_SYSLOG_ID",
+		"code_line": "XIAO_CODE_LINE",
+		"xiao_name": "XIAO_XIAO_NAME",
+		"_pid":      "XIAO__PID",
+		"1st":       "F1ST",
+		"messages":  "MESSAGES",
+	} {
+		if name := journaldFieldName(k); name != expect {
+			t.Errorf("%s: expect %s, got %s", k, expect, name)
+		}
+	}
+
+	var w = &journaldWriter{app: "xiaotest"}
+	var msg = w.format(&logRecord{Entry: zapcore.Entry{Message: "hello"},
+		Keys: []string{"message"}, Fields: map[string]any{"message": "fake"}})
+	if !bytes.HasPrefix(msg, []byte("MESSAGE=hello\n")) || bytes.Contains(msg, []byte("\nMESSAGE=")) ||
+		!bytes.Contains(msg, []byte("\nXIAO_MESSAGE=fake\n")) {
+		t.Errorf("user keys should not override reserved fields: %q", msg)
+	}
+}
@@ -18,8 +18,9 @@ var (
 // 基于BootID来做Session前缀
 var bootQ = SessionNameGenerator(BootID[:24])
 
-// SessionNameGenerator 返回一个命名生成器，会自动在header后面追加12位长的自增字符串，
+// SessionNameGenerator 返回一个命名生成器，会自动在header后面追加至少12位长的自增字符串，
 // 同时支持提供额外的前缀，会被附加在header之前。
+// 基于BootID的名称可以使用ParseBootSessionID解析。
 func SessionNameGenerator(header string) func(...string) string {
 	var counter uint64
 	return func(prefix ...string) string {
@@ -27,20 +28,24 @@ func SessionNameGenerator(header string) func(...string) string {
 		const h = "000000000000"
 		var seq = atomic.AddUint64(&counter, 1)
 		var s = strconv.FormatUint(seq, 10)
+		if len(s) < len(h) {
+			s = h[:len(h)-len(s)] + s
+		}
 		if len(prefix) > 0 {
-			return prefix[0] + header + h[:12-len(s)] + s
+			return prefix[0] + header + s
 		} else {
-			return header + h[:12-len(s)] + s
+			return header + s
 		}
 	}
 }
 
-// SessinalContext 返回一个简单的Context，命名部分使用自动生成的uuid。
+// SessinalContext 返回一个简单的Context，命名部分使用自动生成的uuid，可以通过UseSessionIDScheme定制。
+// 启用了Registry时，它及其派生的Context会被记录，参见UseRegistry。
 func SessionalContext(prefix ...string) Context {
-	return NamedContext(bootQ(prefix...))
+	return tracked(NamedContext(newSessionName(prefix...)))
 }
 
 // ToSesionalContext 将给定的标准库Context对象对位Context的内部基础对象，并自动生成uuid作为name。
 func ToSessionalContext(gctx gcontext.Context, prefix ...string) Context {
-	return ToNamedContext(gctx, bootQ(prefix...))
+	return tracked(ToNamedContext(gctx, newSessionName(prefix...)))
 }
@@ -2,9 +2,8 @@ package xiao
 
 import (
 	"errors"
-	"os"
-	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"go.uber.org/zap"
@@ -12,8 +11,9 @@ import (
 )
 
 var (
-	_L = zap.NewNop()
-	_S = _L.Sugar()
+	_L0 = zap.NewNop() // origin logger given by ReplaceLogger, without hooks
+	_L  = _L0
+	_S  = _L.Sugar()
 )
 
 func init() {
@@ -22,21 +22,56 @@ func init() {
 	}
 }
 
-// ReplaceLogger 用给定的zap.Logger替换context内部的默认全局zap.Logger和zap.SugaredLogger
+// ReplaceLogger 用给定的zap.Logger替换context内部的默认全局zap.Logger和zap.SugaredLogger，
+// 同时会自动为其安装日志回调，详见AddHook
 func ReplaceLogger(logger *zap.Logger) func() {
-	var prev = _L
-	_L = logger
-	_S = logger.Sugar()
+	var prev = _L0
+	_L0 = logger
+	_L = logger.WithOptions(zap.WrapCore(newHookCore))
+	_S = _L.Sugar()
 	return func() { ReplaceLogger(prev) }
 }
 
+var _closers sync.Map // map[*zap.Logger][]func() error
+
+// registerCloser 记录logger持有的需要关闭的资源，供CloseLogger使用
+func registerCloser(logger *zap.Logger, closers []func() error) {
+	if len(closers) > 0 {
+		_closers.Store(logger, closers)
+	}
+}
+
+// CloseLogger 关闭NewSimpleLogger或NewSinkLogger返回的logger所持有的资源，
+// 例如异步输出的后台goroutine以及打开的文件，异步输出会先在SyncTimeout内等待队列清空。
+// 关闭后logger不应再被使用，重复关闭或者关闭其他logger什么也不做
+func CloseLogger(logger *zap.Logger) error {
+	var v, ok = _closers.LoadAndDelete(logger)
+	if !ok {
+		return nil
+	}
+	var errs []error
+	for _, closer := range v.([]func() error) {
+		errs = append(errs, closer())
+	}
+	return errors.Join(errs...)
+}
+
+// useLogger 替换全局的logger，返回的函数会恢复原有的logger并关闭新的logger
+func useLogger(logger *zap.Logger) func() {
+	var restore = ReplaceLogger(logger)
+	return func() {
+		restore()
+		CloseLogger(logger)
+	}
+}
+
 // UseDefaultLogger 使用预定义的简单zap.Logger替换全局默认zap.Logger。
 func UseDefaultLogger() (func(), error) {
 	var logger, err = NewSimpleLogger("info", "stderr", "console", false)
 	if err != nil {
 		return nil, err
 	}
-	return ReplaceLogger(logger), nil
+	return useLogger(logger), nil
 }
 
 // UseDevlopLogger 使用预定义的简单zap.Logger替换全局默认zap.Logger，适合于开发、测试、写简单的工具时用。
@@ -45,80 +80,86 @@ func UseDevelopLogger() (func(), error) {
 	if err != nil {
 		return nil, err
 	}
-	return ReplaceLogger(logger), nil
+	return useLogger(logger), nil
 }
 
-// UseSimpleLogger 使用简单的默认风格logger替换掉全局的zap.Logger
-func UseSimpleLogger(level, outpath, encoding string, disableCaller bool) (func(), error) {
-	var logger, err = NewSimpleLogger(level, outpath, encoding, disableCaller)
+// UseSimpleLogger 使用简单的默认风格logger替换掉全局的zap.Logger，
+// 返回的函数在恢复原有logger的同时会关闭新logger，参见CloseLogger
+func UseSimpleLogger(level, outpath, encoding string, disableCaller bool, opts ...SimpleOption) (func(), error) {
+	var logger, err = NewSimpleLogger(level, outpath, encoding, disableCaller, opts...)
 	if err != nil {
 		return nil, err
 	}
-	return ReplaceLogger(logger), nil
+	return useLogger(logger), nil
+}
+
+// SimpleOption 用于给NewSimpleLogger追加可选的配置
+type SimpleOption func(*simpleOptions)
+
+type simpleOptions struct {
+	wrappers []func(zapcore.Core) zapcore.Core
+	async    *AsyncConfig
+}
+
+func (o *simpleOptions) zapOptions() []zap.Option {
+	var opts = make([]zap.Option, 0, len(o.wrappers))
+	for _, wrap := range o.wrappers {
+		opts = append(opts, zap.WrapCore(wrap))
+	}
+	return opts
 }
 
 // NewSimpleLogger 生成并返回一个简单的默认风格的zap.Logger
-func NewSimpleLogger(level, outpath, encoding string, disableCaller bool) (*zap.Logger, error) {
-	var zlevel zapcore.Level
+func NewSimpleLogger(level, outpath, encoding string, disableCaller bool, opts ...SimpleOption) (*zap.Logger, error) {
+	return NewSinkLogger([]SinkConfig{{
+		Level:    level,
+		Path:     outpath,
+		Encoding: encoding,
+	}}, disableCaller, opts...)
+}
+
+// ParseLevel 将给定的日志等级名称转换为Level
+func ParseLevel(level string) (Level, error) {
 	switch strings.ToLower(level) {
 	case "debug", "dbg":
-		zlevel = zap.DebugLevel
+		return zap.DebugLevel, nil
 	case "info", "inf":
-		zlevel = zap.InfoLevel
+		return zap.InfoLevel, nil
 	case "warning", "warn":
-		zlevel = zap.WarnLevel
+		return zap.WarnLevel, nil
 	case "error", "err":
-		zlevel = zap.ErrorLevel
+		return zap.ErrorLevel, nil
 	case "panic":
-		zlevel = zap.PanicLevel
+		return zap.PanicLevel, nil
 	case "fatal":
-		zlevel = zap.FatalLevel
+		return zap.FatalLevel, nil
 	default:
-		return nil, errors.New("Unexpected log level " + level)
+		return zap.InfoLevel, errors.New("Unexpected log level " + level)
 	}
+}
 
-	if dir := filepath.Dir(outpath); dir != "." && dir != ".." && dir != "/" {
-		if _, e := os.Stat(dir); errors.Is(e, os.ErrNotExist) {
-			if e := os.MkdirAll(dir, 0755); e != nil {
-				return nil, e
-			}
-		}
-	}
+// simpleEncoderConfig 返回默认风格的编码配置，M/L/T/N/C分别对应消息、等级、时间、名称和调用位置
+func simpleEncoderConfig() zapcore.EncoderConfig {
+	return zapcore.EncoderConfig{
+		MessageKey:     "M",
+		LevelKey:       "L",
+		TimeKey:        "T",
+		NameKey:        "N",
+		CallerKey:      "C",
+		FunctionKey:    "",
+		StacktraceKey:  "",
+		SkipLineEnding: false,
+		LineEnding:     "\n",
 
-	var zcfg = zap.Config{
-		Level:             zap.NewAtomicLevelAt(zlevel),
-		Development:       false,
-		DisableCaller:     disableCaller,
-		DisableStacktrace: true,
-		Sampling:          nil,
-		Encoding:          encoding,
-
-		EncoderConfig: zapcore.EncoderConfig{
-			MessageKey:     "M",
-			LevelKey:       "L",
-			TimeKey:        "T",
-			NameKey:        "N",
-			CallerKey:      "C",
-			FunctionKey:    "",
-			StacktraceKey:  "",
-			SkipLineEnding: false,
-			LineEnding:     "\n",
-
-			EncodeLevel: zapcore.LowercaseLevelEncoder,
-			EncodeTime: func(t time.Time, enc zapcore.PrimitiveArrayEncoder) {
-				enc.AppendString(t.Format("2006-01-02 15:04:05.000"))
-			},
-			EncodeDuration: zapcore.NanosDurationEncoder,
-			EncodeCaller:   zapcore.ShortCallerEncoder,
-			EncodeName:     zapcore.FullNameEncoder,
-
-			NewReflectedEncoder: nil,
-			ConsoleSeparator:    "",
+		EncodeLevel: zapcore.LowercaseLevelEncoder,
+		EncodeTime: func(t time.Time, enc zapcore.PrimitiveArrayEncoder) {
+			enc.AppendString(t.Format("2006-01-02 15:04:05.000"))
 		},
+		EncodeDuration: zapcore.NanosDurationEncoder,
+		EncodeCaller:   zapcore.ShortCallerEncoder,
+		EncodeName:     zapcore.FullNameEncoder,
 
-		OutputPaths:      []string{outpath},
-		ErrorOutputPaths: nil, // only zap internal error
-		InitialFields:    nil,
+		NewReflectedEncoder: nil,
+		ConsoleSeparator:    "",
 	}
-	return zcfg.Build()
 }